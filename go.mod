@@ -4,6 +4,8 @@ go 1.20
 
 require (
 	github.com/hashicorp/golang-lru v1.0.2
+	github.com/prometheus/client_model v0.5.0
+	github.com/prometheus/common v0.46.0
 	github.com/sirupsen/logrus v1.9.3
 	github.com/spf13/viper v1.16.0
 	github.com/valyala/fasthttp v1.48.0
@@ -26,12 +28,13 @@ require (
 	github.com/spf13/pflag v1.0.5 // indirect
 	github.com/subosito/gotenv v1.4.2 // indirect
 	github.com/valyala/bytebufferpool v1.0.0 // indirect
-	golang.org/x/text v0.9.0 // indirect
+	golang.org/x/text v0.14.0 // indirect
+	google.golang.org/protobuf v1.32.0 // indirect
 	gopkg.in/ini.v1 v1.67.0 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
 
 require (
 	github.com/stretchr/testify v1.8.4
-	golang.org/x/sys v0.11.0 // indirect
+	golang.org/x/sys v0.16.0 // indirect
 )
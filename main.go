@@ -3,7 +3,9 @@ package main
 import (
 	"backendify/pkg/api"
 	"backendify/pkg/config"
+	"backendify/pkg/logging"
 	"backendify/pkg/models"
+	"backendify/pkg/tracing"
 	"log"
 	"os"
 	"os/signal"
@@ -26,14 +28,23 @@ func main() {
 	if err != nil {
 		log.Fatal(err)
 	}
-	logger := initializeLogger()
+	logger, err := initializeLogger(appConfig)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	tracer, err := tracing.NewTracer(appConfig.Tracing, logger)
+	if err != nil {
+		log.Fatal(err)
+	}
+	tracing.SetTracer(tracer)
 
 	// Create router and server
 	router, err := api.NewRouter(backends, appConfig, logger)
 	if err != nil {
 		log.Fatal(err)
 	}
-	server := createServer(router.HandleRequest, appConfig)
+	server := createServer(router, appConfig)
 
 	// Use a channel to listen for OS interrupt signals (e.g., Ctrl+C)
 	interrupt := make(chan os.Signal, 1)
@@ -59,6 +70,9 @@ func main() {
 	duration := 3 * time.Second
 	time.Sleep(duration)
 	router.ShutDown()
+	if err := tracer.Shutdown(); err != nil {
+		logger.Error("Error shutting down tracer: ", err)
+	}
 }
 
 func loadConfiguration() (config.BackendConfig, *models.Config, error) {
@@ -68,19 +82,20 @@ func loadConfiguration() (config.BackendConfig, *models.Config, error) {
 	return backends, appConfig, err
 }
 
-func initializeLogger() *logrus.Logger {
+func initializeLogger(appConfig *models.Config) (*logrus.Logger, error) {
 	logger := logrus.New()
-	// Configure your logger settings here, if needed
-	return logger
+	err := logging.Configure(logger, appConfig.Logging, appConfig.Application.DebugMode)
+	return logger, err
 }
 
-func createServer(router fasthttp.RequestHandler, appConfig *models.Config) *fasthttp.Server {
+func createServer(router *api.CustomRouter, appConfig *models.Config) *fasthttp.Server {
 	server := &fasthttp.Server{
-		Handler:           router,
+		Handler:           router.HandleRequest,
+		HeaderReceived:    router.RequestConfig,
 		ReadTimeout:       appConfig.Server.ReadTimeout,
 		WriteTimeout:      appConfig.Server.WriteTimeout,
 		ReduceMemoryUsage: appConfig.Server.ReduceMemoryUsage,
-		GetOnly:           appConfig.Server.GetOnly,
+		// GetOnly is enforced by the router, which allows POST on the batch route
 	}
 	return server
 }
@@ -0,0 +1,136 @@
+package api
+
+import (
+	"backendify/pkg/client"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"sync"
+
+	"github.com/valyala/fasthttp"
+)
+
+// BatchItem identifies a company to look up in a batch.
+type BatchItem struct {
+	CountryISO string `json:"country_iso"`
+	ID         string `json:"id"`
+}
+
+// BatchRequest is the body of POST /companies/batch.
+type BatchRequest struct {
+	Items []BatchItem `json:"items"`
+}
+
+// BatchResult is the outcome of a single lookup of a batch, with either the
+// company or the error it failed with.
+type BatchResult struct {
+	CountryISO string      `json:"country_iso"`
+	ID         string      `json:"id"`
+	Status     int         `json:"status"`
+	Stale      bool        `json:"stale,omitempty"`
+	Company    interface{} `json:"company,omitempty"`
+	Error      *Problem    `json:"error,omitempty"`
+}
+
+// BatchResponse lists the results in the order of the requested items.
+type BatchResponse struct {
+	Results []BatchResult `json:"results"`
+}
+
+// GetCompanies looks up a batch of companies, a bounded number at a time,
+// and answers with the result of every lookup.
+func (cr *CustomRouter) GetCompanies(ctx *fasthttp.RequestCtx) {
+	var request BatchRequest
+	err := json.Unmarshal(ctx.PostBody(), &request)
+	// A batch too large to run only counts as one request
+	items := len(request.Items)
+	if err != nil || items > cr.batch.MaxItems {
+		items = 1
+	}
+	if !cr.chargeItems(ctx, items) {
+		return
+	}
+	if err != nil {
+		writeProblem(ctx, fasthttp.StatusBadRequest, kindInvalidRequest, "invalid batch: "+err.Error())
+		return
+	}
+	if len(request.Items) > cr.batch.MaxItems {
+		detail := fmt.Sprintf("batch of %d items exceeds the limit of %d", len(request.Items), cr.batch.MaxItems)
+		writeProblem(ctx, fasthttp.StatusRequestEntityTooLarge, kindInvalidRequest, detail)
+		return
+	}
+
+	version := versionOf(ctx)
+	requestID := requestIDOf(ctx)
+	traceCtx, span := startRequestSpan(ctx)
+	span.SetAttribute("items", strconv.Itoa(len(request.Items)))
+	defer span.End()
+
+	// fasthttp does not report a client going away before the response is
+	// written, so the lookups only end with the handler
+	batchCtx, cancel := context.WithCancel(traceCtx)
+	defer cancel()
+
+	results := make([]BatchResult, len(request.Items))
+	slots := make(chan struct{}, cr.batch.Concurrency)
+	var wg sync.WaitGroup
+	for i, item := range request.Items {
+		slots <- struct{}{}
+		wg.Add(1)
+		go func(i int, item BatchItem) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			results[i] = cr.lookupItem(batchCtx, item, version, requestID)
+		}(i, item)
+	}
+	wg.Wait()
+
+	span.SetAttribute("status", strconv.Itoa(fasthttp.StatusOK))
+	ctx.SetContentType("application/json")
+	ctx.SetStatusCode(fasthttp.StatusOK)
+	json.NewEncoder(ctx).Encode(BatchResponse{Results: results})
+}
+
+// lookupItem looks up a single company of a batch. Batch lookups are queued
+// behind interactive ones, so that a large batch does not starve them. The
+// lookup is bounded by the deadline of the backend, and abandoned along with
+// parent.
+func (cr *CustomRouter) lookupItem(parent context.Context, item BatchItem, version apiVersion, requestID string) BatchResult {
+	result := BatchResult{CountryISO: item.CountryISO, ID: item.ID}
+	fail := func(status int, kind client.ErrorKind, detail string) BatchResult {
+		problem := newProblem(status, kind, detail, version)
+		problem.RequestID = requestID
+		result.Status = status
+		result.Error = &problem
+		return result
+	}
+
+	if item.ID == "" || item.CountryISO == "" {
+		return fail(fasthttp.StatusNotFound, client.KindNotFound, "id and country_iso are required")
+	}
+	if _, found := cr.Backends[item.CountryISO]; !found {
+		return fail(fasthttp.StatusNotFound, client.KindNotFound, client.ErrUnknownBackend.Error())
+	}
+
+	lookupCtx := client.WithRequestID(client.WithPriority(parent, client.PriorityLow), requestID)
+	fetchCtx, cancel := context.WithTimeout(lookupCtx, cr.Upstream.For(item.CountryISO).RequestTimeout)
+	defer cancel()
+	company, err := cr.BackendClient.FetchCompanyData(fetchCtx, item.CountryISO, item.ID)
+	if err != nil {
+		kind := classify(cr.log(requestID), err)
+		return fail(statusFor(kind), kind, err.Error())
+	}
+	if company == nil {
+		return fail(fasthttp.StatusNotFound, client.KindNotFound, client.ErrNotFound.Error())
+	}
+
+	result.Status = fasthttp.StatusOK
+	result.Stale = company.Stale
+	if version == apiV2 {
+		result.Company = company.Details()
+	} else {
+		result.Company = company
+	}
+	return result
+}
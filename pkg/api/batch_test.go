@@ -0,0 +1,76 @@
+package api
+
+import (
+	"backendify/pkg/config"
+	"backendify/pkg/models"
+	"encoding/json"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/valyala/fasthttp"
+)
+
+func TestGetCompanies(t *testing.T) {
+	appConfig := models.Config{
+		Server: models.ServerConfig{
+			GetOnly: true,
+		},
+		Application: models.ApplicationConfig{
+			MockFlag: true,
+			Batch:    models.BatchConfig{MaxItems: 3},
+		},
+	}
+	router, err := NewRouter(config.BackendConfig{"us": "http://localhost:9001"}, &appConfig, logrus.New())
+	assert.Nil(t, err)
+
+	request := func(method, uri, body string) *fasthttp.RequestCtx {
+		ctx := newRequestCtx()
+		ctx.Request.Header.SetMethod(method)
+		ctx.Request.SetRequestURI(uri)
+		ctx.Request.SetBodyString(body)
+		router.HandleRequest(ctx)
+		return ctx
+	}
+
+	t.Run("Per-item results", func(t *testing.T) {
+		ctx := request("POST", "/companies/batch", `{"items":[{"country_iso":"us","id":"1"},{"country_iso":"xx","id":"2"},{"country_iso":"us"}]}`)
+		assert.Equal(t, fasthttp.StatusOK, ctx.Response.StatusCode())
+
+		var response BatchResponse
+		assert.NoError(t, json.Unmarshal(ctx.Response.Body(), &response))
+		if assert.Len(t, response.Results, 3) {
+			assert.Equal(t, fasthttp.StatusOK, response.Results[0].Status)
+			assert.NotNil(t, response.Results[0].Company)
+			assert.Nil(t, response.Results[0].Error)
+
+			assert.Equal(t, "xx", response.Results[1].CountryISO)
+			assert.Equal(t, fasthttp.StatusNotFound, response.Results[1].Status)
+			if assert.NotNil(t, response.Results[1].Error) {
+				assert.Equal(t, "/problems/not_found", response.Results[1].Error.Type)
+			}
+
+			assert.Equal(t, fasthttp.StatusNotFound, response.Results[2].Status)
+		}
+	})
+
+	t.Run("Batch too large", func(t *testing.T) {
+		ctx := request("POST", "/companies/batch", `{"items":[{},{},{},{}]}`)
+		assert.Equal(t, fasthttp.StatusRequestEntityTooLarge, ctx.Response.StatusCode())
+	})
+
+	t.Run("Invalid body", func(t *testing.T) {
+		ctx := request("POST", "/companies/batch", `[`)
+		assert.Equal(t, fasthttp.StatusBadRequest, ctx.Response.StatusCode())
+	})
+
+	t.Run("Methods are checked per route", func(t *testing.T) {
+		ctx := request("GET", "/companies/batch", "")
+		assert.Equal(t, fasthttp.StatusMethodNotAllowed, ctx.Response.StatusCode())
+		assert.Equal(t, "POST", string(ctx.Response.Header.Peek("Allow")))
+
+		ctx = request("POST", "/company?id=1&country_iso=us", "")
+		assert.Equal(t, fasthttp.StatusMethodNotAllowed, ctx.Response.StatusCode())
+		assert.Equal(t, "GET", string(ctx.Response.Header.Peek("Allow")))
+	})
+}
@@ -0,0 +1,103 @@
+package api
+
+import (
+	"backendify/pkg/client"
+	"encoding/json"
+
+	"github.com/valyala/fasthttp"
+)
+
+// Problem kinds of failures that do not come from the backend client.
+const (
+	kindRateLimited      client.ErrorKind = "rate_limited"
+	kindNoRoute          client.ErrorKind = "no_route"
+	kindMethodNotAllowed client.ErrorKind = "method_not_allowed"
+	kindInvalidRequest   client.ErrorKind = "invalid_request"
+)
+
+// Problem is an RFC 7807 error body, so that clients can tell a missing
+// company from a failure worth retrying and parse every failure the same way.
+type Problem struct {
+	Type      string `json:"type"`
+	Title     string `json:"title"`
+	Status    int    `json:"status"`
+	Detail    string `json:"detail,omitempty"`
+	RequestID string `json:"request_id,omitempty"`
+	Country   string `json:"country,omitempty"`
+	ID        string `json:"id,omitempty"`
+
+	// Members added by v2 of the API
+	Code      client.ErrorKind `json:"code,omitempty"`
+	Retryable *bool            `json:"retryable,omitempty"`
+}
+
+// retryableKinds are the failures a client may retry the same request after.
+var retryableKinds = map[client.ErrorKind]bool{
+	client.KindUnavailable: true,
+	client.KindTimeout:     true,
+	client.KindOverloaded:  true,
+	kindRateLimited:        true,
+}
+
+// kindStatus maps the kinds of lookup failures to the status codes they are answered with.
+var kindStatus = map[client.ErrorKind]int{
+	client.KindNotFound:    fasthttp.StatusNotFound,
+	client.KindUnavailable: fasthttp.StatusBadGateway,
+	client.KindTimeout:     fasthttp.StatusGatewayTimeout,
+	client.KindBadPayload:  fasthttp.StatusUnprocessableEntity,
+	client.KindOverloaded:  fasthttp.StatusServiceUnavailable,
+}
+
+var kindTitles = map[client.ErrorKind]string{
+	client.KindNotFound:    "Company not found",
+	client.KindUnavailable: "Upstream unavailable",
+	client.KindTimeout:     "Upstream timeout",
+	client.KindBadPayload:  "Malformed upstream payload",
+	client.KindOverloaded:  "Service overloaded",
+	kindRateLimited:        "Too many requests",
+	kindNoRoute:            "Not found",
+	kindMethodNotAllowed:   "Method not allowed",
+	kindInvalidRequest:     "Invalid request",
+}
+
+// statusFor returns the status code a failure of the given kind is answered with.
+func statusFor(kind client.ErrorKind) int {
+	if status, ok := kindStatus[kind]; ok {
+		return status
+	}
+	return fasthttp.StatusBadGateway
+}
+
+// newProblem describes a failure of the given kind for an API version.
+func newProblem(status int, kind client.ErrorKind, detail string, version apiVersion) Problem {
+	title, ok := kindTitles[kind]
+	if !ok {
+		title = fasthttp.StatusMessage(status)
+	}
+
+	problem := Problem{
+		Type:   "/problems/" + string(kind),
+		Title:  title,
+		Status: status,
+		Detail: detail,
+	}
+	if version == apiV2 {
+		retryable := retryableKinds[kind]
+		problem.Code = kind
+		problem.Retryable = &retryable
+	}
+	return problem
+}
+
+// writeProblem answers with the given status and a problem+json body
+// describing the failure and the company lookup it happened to.
+func writeProblem(ctx *fasthttp.RequestCtx, status int, kind client.ErrorKind, detail string) {
+	problem := newProblem(status, kind, detail, versionOf(ctx))
+	problem.RequestID = requestIDOf(ctx)
+	problem.Country = string(ctx.QueryArgs().Peek("country_iso"))
+	problem.ID = string(ctx.QueryArgs().Peek("id"))
+
+	ctx.SetContentType("application/problem+json")
+	ctx.SetStatusCode(status)
+	json.NewEncoder(ctx).Encode(problem)
+}
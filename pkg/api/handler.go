@@ -1,17 +1,35 @@
 package api
 
 import (
+	"backendify/pkg/client"
 	"backendify/pkg/models"
+	"backendify/pkg/tracing"
+	"context"
 	"encoding/json"
+	"errors"
+	"strconv"
 
+	"github.com/sirupsen/logrus"
 	"github.com/valyala/fasthttp"
 )
 
+// StatusReport is the detailed status, returned by /status?verbose.
+type StatusReport struct {
+	Ready    bool                           `json:"ready"`
+	Breakers map[string]client.BreakerStats `json:"breakers"`
+}
+
 func (cr *CustomRouter) Status(ctx *fasthttp.RequestCtx) {
+	// Report the state of the backends as well when asked for details
+	if ctx.QueryArgs().Has("verbose") {
+		cr.verboseStatus(ctx)
+		return
+	}
+
 	// Check if your solution is ready to accept requests
 	if !cr.IsReadyToAcceptRequests() {
 		// If not ready, return a 503 status code (Service Unavailable)
-		ctx.SetStatusCode(fasthttp.StatusServiceUnavailable)
+		writeProblem(ctx, statusFor(client.KindOverloaded), client.KindOverloaded, "not ready to accept requests")
 		return
 	}
 
@@ -21,28 +39,90 @@ func (cr *CustomRouter) Status(ctx *fasthttp.RequestCtx) {
 	ctx.Write([]byte("OK"))
 }
 
+func (cr *CustomRouter) verboseStatus(ctx *fasthttp.RequestCtx) {
+	report := StatusReport{
+		Ready:    cr.IsReadyToAcceptRequests(),
+		Breakers: cr.BackendClient.Stats().Breakers,
+	}
+
+	ctx.SetContentType("application/json")
+	if report.Ready {
+		ctx.SetStatusCode(fasthttp.StatusOK)
+	} else {
+		ctx.SetStatusCode(fasthttp.StatusServiceUnavailable)
+	}
+	json.NewEncoder(ctx).Encode(report)
+}
+
+// PoolStats reports the size and saturation of the worker pool as JSON.
+func (cr *CustomRouter) PoolStats(ctx *fasthttp.RequestCtx) {
+	ctx.SetContentType("application/json")
+	ctx.SetStatusCode(fasthttp.StatusOK)
+	json.NewEncoder(ctx).Encode(cr.BackendClient.Stats().Pool)
+}
+
+// CoalescingStats reports how many lookups were collapsed into shared upstream requests as JSON.
+func (cr *CustomRouter) CoalescingStats(ctx *fasthttp.RequestCtx) {
+	ctx.SetContentType("application/json")
+	ctx.SetStatusCode(fasthttp.StatusOK)
+	json.NewEncoder(ctx).Encode(cr.BackendClient.Stats().Coalescing)
+}
+
+// BackendHealth reports the health of every country backend as JSON.
+func (cr *CustomRouter) BackendHealth(ctx *fasthttp.RequestCtx) {
+	report := cr.BackendClient.Health()
+
+	ctx.SetContentType("application/json")
+	if report.Healthy {
+		ctx.SetStatusCode(fasthttp.StatusOK)
+	} else {
+		ctx.SetStatusCode(fasthttp.StatusServiceUnavailable)
+	}
+	json.NewEncoder(ctx).Encode(report)
+}
+
 // Define a function to check if your solution is ready
 func (cr *CustomRouter) IsReadyToAcceptRequests() bool {
-	return cr.BackendClient.WorkersAvailable()
+	if !cr.BackendClient.WorkersAvailable() {
+		return false
+	}
+	// Optionally hold off traffic until every country has a healthy backend
+	return !cr.Upstream.HealthCheck.RequireHealthy || cr.BackendClient.Health().Healthy
 }
 
 func (cr *CustomRouter) GetCompany(ctx *fasthttp.RequestCtx) {
 	id := string(ctx.QueryArgs().Peek("id"))
 	iso := string(ctx.QueryArgs().Peek("country_iso"))
+	requestID := requestIDOf(ctx)
+	log := cr.log(requestID)
+
+	traceCtx, span := startRequestSpan(ctx)
+	span.SetAttribute("country", iso)
+	span.SetAttribute("id", id)
+	defer func() {
+		span.SetAttribute("status", strconv.Itoa(ctx.Response.StatusCode()))
+		span.End()
+	}()
 
 	// Check if either 'id' or 'country_iso' is missing
 	if id == "" || iso == "" {
-		ctx.SetStatusCode(fasthttp.StatusNotFound)
+		writeProblem(ctx, fasthttp.StatusNotFound, client.KindNotFound, "id and country_iso are required")
 		return
 	}
 
 	// Check if ISO code is associated with a backend
-	backend, found := cr.Backends[iso]
-	if !found {
-		ctx.SetStatusCode(fasthttp.StatusNotFound)
+	if _, found := cr.Backends[iso]; !found {
+		writeProblem(ctx, fasthttp.StatusNotFound, client.KindNotFound, client.ErrUnknownBackend.Error())
 		return
 	}
 
+	// Bound the whole lookup by the SLA deadline of the backend
+	info := &client.LookupInfo{}
+	ctx.SetUserValue(lookupInfoKey, info)
+	lookupCtx := client.WithRequestID(client.WithLookupInfo(traceCtx, info), requestID)
+	fetchCtx, cancel := context.WithTimeout(lookupCtx, cr.Upstream.For(iso).RequestTimeout)
+	defer cancel()
+
 	// Use a buffered channel to communicate the response
 	ch := make(chan struct {
 		company *models.Company
@@ -50,8 +130,17 @@ func (cr *CustomRouter) GetCompany(ctx *fasthttp.RequestCtx) {
 	}, 1)
 
 	// Acquire a semaphore before starting the goroutine
-	if err := cr.fetchSemaphore.Acquire(ctx, 1); err != nil {
-		ctx.SetStatusCode(fasthttp.StatusTooManyRequests)
+	_, semaphoreSpan := tracing.Start(fetchCtx, "semaphore")
+	err := cr.fetchSemaphore.Acquire(fetchCtx, 1)
+	semaphoreSpan.SetError(err)
+	semaphoreSpan.End()
+	if err != nil {
+		span.SetError(err)
+		if errors.Is(err, context.DeadlineExceeded) {
+			writeProblem(ctx, statusFor(client.KindTimeout), client.KindTimeout, "no lookup slot within the deadline")
+			return
+		}
+		writeProblem(ctx, statusFor(client.KindOverloaded), client.KindOverloaded, err.Error())
 		return
 	}
 	defer cr.fetchSemaphore.Release(1)
@@ -59,7 +148,7 @@ func (cr *CustomRouter) GetCompany(ctx *fasthttp.RequestCtx) {
 	// Start a goroutine to fetch company data concurrently
 	go func() {
 		defer close(ch) // Close the channel when done
-		company, err := cr.BackendClient.FetchCompanyData(backend, id)
+		company, err := cr.BackendClient.FetchCompanyData(fetchCtx, iso, id)
 		ch <- struct {
 			company *models.Company
 			err     error
@@ -69,20 +158,44 @@ func (cr *CustomRouter) GetCompany(ctx *fasthttp.RequestCtx) {
 	// Wait for the goroutine to finish and send the response
 	result := <-ch
 	if result.err != nil {
-		cr.Logger.Error("An error occurred:", result.err)
-		ctx.SetStatusCode(fasthttp.StatusNotFound)
+		span.SetError(result.err)
+		kind := classify(log, result.err)
+		writeProblem(ctx, statusFor(kind), kind, result.err.Error())
 		return
 	}
 
 	if result.company == nil {
-		ctx.SetStatusCode(fasthttp.StatusNotFound)
+		writeProblem(ctx, fasthttp.StatusNotFound, client.KindNotFound, client.ErrNotFound.Error())
 		return
 	}
 
+	// Let callers know the backend failed and they got an expired copy
+	if result.company.Stale {
+		ctx.Response.Header.Set("X-Cache-Status", "STALE")
+	}
+
 	// Respond with company data
-	cr.Logger.Info("Company data retrieved successfully")
+	log.Debug("Company data retrieved successfully")
 	ctx.SetContentType("application/json")
 	ctx.SetStatusCode(fasthttp.StatusOK)
 
+	// The detailed representation is opt-in, so that existing consumers keep their response shape
+	if versionOf(ctx) == apiV2 {
+		json.NewEncoder(ctx).Encode(result.company.Details())
+		return
+	}
 	json.NewEncoder(ctx).Encode(result.company)
 }
+
+// classify returns the kind of a lookup failure, logging the ones worth a look.
+func classify(log *logrus.Entry, err error) client.ErrorKind {
+	kind := client.KindOf(err)
+	switch kind {
+	case client.KindNotFound:
+	case client.KindTimeout, client.KindOverloaded:
+		log.Warn("Lookup failed: ", err)
+	default:
+		log.Error("An error occurred:", err)
+	}
+	return kind
+}
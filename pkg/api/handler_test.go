@@ -1,7 +1,10 @@
 package api
 
 import (
+	"backendify/pkg/client"
+	"backendify/pkg/client/mocks"
 	"backendify/pkg/models"
+	"encoding/json"
 	"testing"
 
 	"github.com/sirupsen/logrus"
@@ -56,7 +59,7 @@ func TestGetCompany(t *testing.T) {
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
 			// Create a new fasthttp.RequestCtx for testing.
-			ctx := &fasthttp.RequestCtx{}
+			ctx := newRequestCtx()
 			ctx.Request.Header.SetMethod("GET")
 			ctx.Request.SetRequestURI(tc.requestURI)
 
@@ -76,3 +79,59 @@ func TestGetCompany(t *testing.T) {
 		})
 	}
 }
+
+func TestGetCompanyDetails(t *testing.T) {
+	config := models.Config{
+		Application: models.ApplicationConfig{
+			MockFlag: true,
+		},
+	}
+	r, err := NewRouter(map[string]string{"us": "http://example.com"}, &config, logrus.New())
+	assert.Nil(t, err)
+
+	ctx := newRequestCtx()
+	ctx.Request.Header.SetMethod("GET")
+	ctx.Request.SetRequestURI("/company?id=1&country_iso=us")
+	r.HandleRequest(ctx)
+	assert.Equal(t, fasthttp.StatusOK, ctx.Response.StatusCode())
+	assert.NotContains(t, string(ctx.Response.Body()), "fetched_at")
+
+	ctx = newRequestCtx()
+	ctx.Request.Header.SetMethod("GET")
+	ctx.Request.SetRequestURI("/company?id=1&country_iso=us&version=2")
+	r.HandleRequest(ctx)
+	assert.Equal(t, fasthttp.StatusOK, ctx.Response.StatusCode())
+	assert.Contains(t, string(ctx.Response.Body()), `"fetched_at"`)
+}
+
+// unavailableClient is a mock client whose pool cannot take requests.
+type unavailableClient struct {
+	mocks.MockBackendClient
+}
+
+func (unavailableClient) WorkersAvailable() bool {
+	return false
+}
+
+func TestStatusNotReady(t *testing.T) {
+	config := models.Config{
+		Application: models.ApplicationConfig{
+			MockFlag: true,
+		},
+	}
+	r, err := NewRouter(map[string]string{"us": "http://example.com"}, &config, logrus.New())
+	assert.Nil(t, err)
+	r.BackendClient = unavailableClient{}
+
+	ctx := newRequestCtx()
+	ctx.Request.Header.SetMethod("GET")
+	ctx.Request.SetRequestURI("/status")
+	r.HandleRequest(ctx)
+
+	assert.Equal(t, fasthttp.StatusServiceUnavailable, ctx.Response.StatusCode())
+	assert.Equal(t, "application/problem+json", string(ctx.Response.Header.ContentType()))
+	var problem Problem
+	assert.NoError(t, json.Unmarshal(ctx.Response.Body(), &problem))
+	assert.Equal(t, fasthttp.StatusServiceUnavailable, problem.Status)
+	assert.Contains(t, problem.Type, string(client.KindOverloaded))
+}
@@ -0,0 +1,281 @@
+package api
+
+import (
+	"backendify/pkg/models"
+	"encoding/json"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+
+	lru "github.com/hashicorp/golang-lru"
+	"github.com/valyala/fasthttp"
+)
+
+const (
+	defaultAPIKeyHeader      = "X-API-Key"
+	defaultMaxTrackedClients = 10000
+)
+
+// tokenBucket holds up to capacity tokens and refills them evenly over period.
+type tokenBucket struct {
+	mu       sync.Mutex
+	capacity float64
+	tokens   float64
+	rate     float64 // tokens per second
+	last     time.Time
+}
+
+func newTokenBucket(limit int, period time.Duration) *tokenBucket {
+	return &tokenBucket{
+		capacity: float64(limit),
+		tokens:   float64(limit),
+		rate:     float64(limit) / period.Seconds(),
+		last:     time.Now(),
+	}
+}
+
+func (b *tokenBucket) refill(now time.Time) {
+	elapsed := now.Sub(b.last).Seconds()
+	if elapsed > 0 {
+		b.tokens = math.Min(b.capacity, b.tokens+elapsed*b.rate)
+		b.last = now
+	}
+}
+
+// take consumes n tokens if they are available, otherwise it returns how long
+// the caller has to wait for them. More tokens than the bucket holds are taken
+// from a full bucket, which is left in debt until it refills.
+func (b *tokenBucket) take(now time.Time, n float64) (bool, time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.refill(now)
+	need := math.Min(n, b.capacity)
+	if b.tokens >= need {
+		b.tokens -= n
+		return true, 0
+	}
+	wait := (need - b.tokens) / b.rate
+	return false, time.Duration(wait * float64(time.Second))
+}
+
+// refund gives back the n tokens taken for a request that was rejected by another bucket.
+func (b *tokenBucket) refund(n float64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.tokens = math.Min(b.capacity, b.tokens+n)
+}
+
+// BucketState is a snapshot of a single bucket, used for debugging.
+type BucketState struct {
+	Tokens   float64 `json:"tokens"`
+	Capacity float64 `json:"capacity"`
+}
+
+func (b *tokenBucket) state(now time.Time) BucketState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refill(now)
+	return BucketState{Tokens: math.Floor(b.tokens*100) / 100, Capacity: b.capacity}
+}
+
+// bucketSet keeps one bucket per client key, evicting the least recently seen clients.
+type bucketSet struct {
+	limit  int
+	period time.Duration
+	cache  *lru.Cache
+}
+
+func newBucketSet(limit int, period time.Duration, size int) (*bucketSet, error) {
+	cache, err := lru.New(size)
+	if err != nil {
+		return nil, err
+	}
+	return &bucketSet{limit: limit, period: period, cache: cache}, nil
+}
+
+func (s *bucketSet) get(key string) *tokenBucket {
+	if b, ok := s.cache.Get(key); ok {
+		return b.(*tokenBucket)
+	}
+	b := newTokenBucket(s.limit, s.period)
+	if previous, ok, _ := s.cache.PeekOrAdd(key, b); ok {
+		return previous.(*tokenBucket)
+	}
+	return b
+}
+
+func (s *bucketSet) states(now time.Time, mask bool) map[string]BucketState {
+	states := make(map[string]BucketState)
+	for _, key := range s.cache.Keys() {
+		b, ok := s.cache.Peek(key)
+		if !ok {
+			continue
+		}
+		name := key.(string)
+		if mask {
+			name = maskKey(name)
+		}
+		states[name] = b.(*tokenBucket).state(now)
+	}
+	return states
+}
+
+// maskKey hides all but the first characters of an API key.
+func maskKey(key string) string {
+	if len(key) <= 4 {
+		return "****"
+	}
+	return key[:4] + "****"
+}
+
+// RateLimiter enforces the configured limits globally, per client IP and per API key.
+type RateLimiter struct {
+	global       *tokenBucket
+	perIP        *bucketSet
+	perAPIKey    *bucketSet
+	apiKeyHeader string
+}
+
+// NewRateLimiter builds a RateLimiter from the limiter configuration.
+// A limit of zero disables the corresponding bucket.
+func NewRateLimiter(config models.LimiterConfig) (*RateLimiter, error) {
+	rl := &RateLimiter{apiKeyHeader: config.APIKeyHeader}
+	if rl.apiKeyHeader == "" {
+		rl.apiKeyHeader = defaultAPIKeyHeader
+	}
+
+	if config.Limit <= 0 && config.PerIPLimit <= 0 && config.PerAPIKeyLimit <= 0 {
+		return rl, nil
+	}
+
+	period, err := time.ParseDuration(config.Period)
+	if err != nil {
+		return nil, err
+	}
+	if period <= 0 {
+		period = time.Second
+	}
+
+	maxClients := config.MaxTrackedClients
+	if maxClients <= 0 {
+		maxClients = defaultMaxTrackedClients
+	}
+
+	if config.Limit > 0 {
+		rl.global = newTokenBucket(config.Limit, period)
+	}
+	if config.PerIPLimit > 0 {
+		if rl.perIP, err = newBucketSet(config.PerIPLimit, period, maxClients); err != nil {
+			return nil, err
+		}
+	}
+	if config.PerAPIKeyLimit > 0 {
+		if rl.perAPIKey, err = newBucketSet(config.PerAPIKeyLimit, period, maxClients); err != nil {
+			return nil, err
+		}
+	}
+	return rl, nil
+}
+
+// Allow reports whether the request may proceed and, if not, when it may be retried.
+func (rl *RateLimiter) Allow(ctx *fasthttp.RequestCtx) (bool, time.Duration) {
+	return rl.AllowN(ctx, 1)
+}
+
+// AllowN is Allow for a request that counts as n requests, as a batch does.
+func (rl *RateLimiter) AllowN(ctx *fasthttp.RequestCtx, n int) (bool, time.Duration) {
+	now := time.Now()
+
+	var buckets []*tokenBucket
+	if rl.perAPIKey != nil {
+		if key := string(ctx.Request.Header.Peek(rl.apiKeyHeader)); key != "" {
+			buckets = append(buckets, rl.perAPIKey.get(key))
+		}
+	}
+	if rl.perIP != nil {
+		buckets = append(buckets, rl.perIP.get(ctx.RemoteIP().String()))
+	}
+	if rl.global != nil {
+		buckets = append(buckets, rl.global)
+	}
+
+	for i, b := range buckets {
+		if ok, wait := b.take(now, float64(n)); !ok {
+			// Give back the tokens already taken from the narrower buckets
+			for _, taken := range buckets[:i] {
+				taken.refund(float64(n))
+			}
+			return false, wait
+		}
+	}
+	return true, 0
+}
+
+// LimiterState is a snapshot of all buckets, used for debugging.
+type LimiterState struct {
+	Global       *BucketState           `json:"global,omitempty"`
+	PerIP        map[string]BucketState `json:"per_ip,omitempty"`
+	PerAPIKey    map[string]BucketState `json:"per_api_key,omitempty"`
+	APIKeyHeader string                 `json:"api_key_header"`
+}
+
+// State returns the current state of every bucket.
+func (rl *RateLimiter) State() LimiterState {
+	now := time.Now()
+	state := LimiterState{APIKeyHeader: rl.apiKeyHeader}
+	if rl.global != nil {
+		global := rl.global.state(now)
+		state.Global = &global
+	}
+	if rl.perIP != nil {
+		state.PerIP = rl.perIP.states(now, false)
+	}
+	if rl.perAPIKey != nil {
+		state.PerAPIKey = rl.perAPIKey.states(now, true)
+	}
+	return state
+}
+
+// RateLimitMiddleware rejects requests over the limit with 429 and a Retry-After header.
+func RateLimitMiddleware(limiter *RateLimiter, next fasthttp.RequestHandler) fasthttp.RequestHandler {
+	return fasthttp.RequestHandler(func(ctx *fasthttp.RequestCtx) {
+		if ok, wait := limiter.Allow(ctx); !ok {
+			rejectRateLimited(ctx, wait)
+			return
+		}
+		next(ctx)
+	})
+}
+
+// chargeItems is RateLimitMiddleware for the batch and stream routes, where a
+// request counts as many requests as it has items, and at least one. It
+// answers 429 and returns false when the items are over the limit.
+func (cr *CustomRouter) chargeItems(ctx *fasthttp.RequestCtx, items int) bool {
+	if items < 1 {
+		items = 1
+	}
+	if ok, wait := cr.limiter.AllowN(ctx, items); !ok {
+		rejectRateLimited(ctx, wait)
+		return false
+	}
+	return true
+}
+
+// rejectRateLimited answers 429 with a Retry-After header of wait, in whole seconds.
+func rejectRateLimited(ctx *fasthttp.RequestCtx, wait time.Duration) {
+	retryAfter := int(math.Ceil(wait.Seconds()))
+	if retryAfter < 1 {
+		retryAfter = 1
+	}
+	ctx.Response.Header.Set("Retry-After", strconv.Itoa(retryAfter))
+	writeProblem(ctx, fasthttp.StatusTooManyRequests, kindRateLimited, "retry after "+strconv.Itoa(retryAfter)+"s")
+}
+
+// RateLimitState reports the current bucket state of the rate limiter as JSON.
+func (cr *CustomRouter) RateLimitState(ctx *fasthttp.RequestCtx) {
+	ctx.SetContentType("application/json")
+	ctx.SetStatusCode(fasthttp.StatusOK)
+	json.NewEncoder(ctx).Encode(cr.limiter.State())
+}
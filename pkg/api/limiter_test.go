@@ -0,0 +1,126 @@
+package api
+
+import (
+	"backendify/pkg/config"
+	"backendify/pkg/models"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/valyala/fasthttp"
+)
+
+func TestRateLimitMiddleware(t *testing.T) {
+	okHandler := func(ctx *fasthttp.RequestCtx) {
+		ctx.SetStatusCode(fasthttp.StatusOK)
+	}
+
+	newCtx := func(apiKey string) *fasthttp.RequestCtx {
+		ctx := newRequestCtx()
+		ctx.Request.SetRequestURI("/company?id=1&country_iso=us")
+		if apiKey != "" {
+			ctx.Request.Header.Set("X-API-Key", apiKey)
+		}
+		return ctx
+	}
+
+	t.Run("Global limit", func(t *testing.T) {
+		limiter, err := NewRateLimiter(models.LimiterConfig{Limit: 2, Period: "1m"})
+		assert.Nil(t, err)
+		handler := RateLimitMiddleware(limiter, okHandler)
+
+		for i := 0; i < 2; i++ {
+			ctx := newCtx("")
+			handler(ctx)
+			assert.Equal(t, fasthttp.StatusOK, ctx.Response.StatusCode())
+		}
+
+		ctx := newCtx("")
+		handler(ctx)
+		assert.Equal(t, fasthttp.StatusTooManyRequests, ctx.Response.StatusCode())
+		assert.Equal(t, "30", string(ctx.Response.Header.Peek("Retry-After")))
+	})
+
+	t.Run("Per API key limit", func(t *testing.T) {
+		limiter, err := NewRateLimiter(models.LimiterConfig{Limit: 10, PerAPIKeyLimit: 1, Period: "1m"})
+		assert.Nil(t, err)
+		handler := RateLimitMiddleware(limiter, okHandler)
+
+		ctx := newCtx("key-a")
+		handler(ctx)
+		assert.Equal(t, fasthttp.StatusOK, ctx.Response.StatusCode())
+
+		ctx = newCtx("key-a")
+		handler(ctx)
+		assert.Equal(t, fasthttp.StatusTooManyRequests, ctx.Response.StatusCode())
+
+		ctx = newCtx("key-b")
+		handler(ctx)
+		assert.Equal(t, fasthttp.StatusOK, ctx.Response.StatusCode())
+
+		// The rejected request must not have used up a global token
+		state := limiter.State()
+		assert.Equal(t, 8.0, state.Global.Tokens)
+		assert.Contains(t, state.PerAPIKey, "key-****")
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		limiter, err := NewRateLimiter(models.LimiterConfig{})
+		assert.Nil(t, err)
+		handler := RateLimitMiddleware(limiter, okHandler)
+
+		for i := 0; i < 5; i++ {
+			ctx := newCtx("")
+			handler(ctx)
+			assert.Equal(t, fasthttp.StatusOK, ctx.Response.StatusCode())
+		}
+	})
+}
+
+func TestTokenBucketLargeCharge(t *testing.T) {
+	now := time.Now()
+	bucket := newTokenBucket(10, 10*time.Second)
+	bucket.last = now
+
+	ok, _ := bucket.take(now, 1)
+	assert.True(t, ok)
+	ok, wait := bucket.take(now, 25)
+	assert.False(t, ok, "Expected a charge over the capacity to wait for a full bucket")
+	assert.Equal(t, time.Second, wait)
+
+	later := now.Add(time.Second)
+	ok, _ = bucket.take(later, 25)
+	assert.True(t, ok)
+	assert.Equal(t, -15.0, bucket.state(later).Tokens, "Expected the bucket to be left in debt")
+	ok, wait = bucket.take(later, 1)
+	assert.False(t, ok)
+	assert.Equal(t, 16*time.Second, wait)
+}
+
+func TestItemRateLimit(t *testing.T) {
+	appConfig := models.Config{
+		Application: models.ApplicationConfig{MockFlag: true},
+		Limiter:     models.LimiterConfig{Limit: 5, Period: "1m"},
+	}
+	router, err := NewRouter(config.BackendConfig{"us": "http://localhost:9001"}, &appConfig, logrus.New())
+	assert.Nil(t, err)
+
+	request := func(method, uri, body string) int {
+		ctx := newRequestCtx()
+		ctx.Request.Header.SetMethod(method)
+		ctx.Request.SetRequestURI(uri)
+		ctx.Request.SetBodyString(body)
+		router.HandleRequest(ctx)
+		return ctx.Response.StatusCode()
+	}
+	const item = `{"country_iso":"us","id":"1"}`
+
+	assert.Equal(t, fasthttp.StatusOK, request("POST", "/companies/batch", `{"items":[`+item+`,`+item+`,`+item+`]}`))
+	assert.Equal(t, 2.0, router.limiter.State().Global.Tokens, "Expected a token per item")
+	assert.Equal(t, fasthttp.StatusTooManyRequests, request("POST", "/companies/batch", `{"items":[`+item+`,`+item+`,`+item+`]}`))
+	assert.Equal(t, fasthttp.StatusOK, request("POST", "/companies/stream", item+"\n\n"+item+"\n"))
+	assert.Equal(t, fasthttp.StatusTooManyRequests, request("GET", "/company?id=1&country_iso=us", ""))
+	assert.Equal(t, fasthttp.StatusTooManyRequests, request("POST", "/companies/batch", "not json"),
+		"Expected an invalid batch to count as a request")
+}
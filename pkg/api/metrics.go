@@ -0,0 +1,66 @@
+package api
+
+import (
+	"backendify/pkg/metrics"
+	"strconv"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+// routes are the paths served by the router, used as the route label so that
+// unknown paths do not each get a metric of their own.
+var routes = map[string]bool{
+	"/status":           true,
+	"/company":          true,
+	"/v1/company":       true,
+	"/v2/company":       true,
+	"/companies/batch":  true,
+	"/companies/stream": true,
+	"/health/backends":  true,
+	"/metrics":          true,
+	"/debug/ratelimit":  true,
+	"/debug/pool":       true,
+	"/debug/coalescing": true,
+}
+
+// requestMetrics measures the requests served by the router.
+type requestMetrics struct {
+	requests *metrics.CounterVec
+	duration *metrics.HistogramVec
+}
+
+func newRequestMetrics() requestMetrics {
+	return requestMetrics{
+		requests: metrics.NewCounterVec("backendify_http_requests_total",
+			"Requests served, by route, status and country.",
+			"route", "status", "country"),
+		duration: metrics.NewHistogramVec("backendify_http_request_duration_seconds",
+			"Time spent serving a request, by route, status and country.",
+			metrics.DefaultBuckets, "route", "status", "country"),
+	}
+}
+
+// observe records a request once it is served. Streamed responses are
+// measured until their stream starts.
+func (cr *CustomRouter) observe(ctx *fasthttp.RequestCtx, start time.Time) {
+	route := string(ctx.Path())
+	if !routes[route] {
+		route = "unmatched"
+	}
+	country := string(ctx.QueryArgs().Peek("country_iso"))
+	if _, found := cr.Backends[country]; !found {
+		country = ""
+	}
+	status := strconv.Itoa(ctx.Response.StatusCode())
+
+	cr.requestMetrics.requests.Inc(route, status, country)
+	cr.requestMetrics.duration.Observe(time.Since(start).Seconds(), route, status, country)
+}
+
+// Metrics exposes the metrics of the service in the Prometheus text format.
+func (cr *CustomRouter) Metrics(ctx *fasthttp.RequestCtx) {
+	ctx.SetContentType(metrics.ContentType)
+	ctx.SetStatusCode(fasthttp.StatusOK)
+	cr.metrics.WriteTo(ctx)
+}
@@ -1,28 +1,157 @@
 package api
 
 import (
+	"backendify/pkg/client"
+	"backendify/pkg/logging"
+	"backendify/pkg/models"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
 	"time"
 
 	"github.com/sirupsen/logrus"
 	"github.com/valyala/fasthttp"
 )
 
-func LoggingMiddleware(next fasthttp.RequestHandler) fasthttp.RequestHandler {
-	return fasthttp.RequestHandler(func(ctx *fasthttp.RequestCtx) {
-		startTime := time.Now()
+var ErrUnknownLogField = errors.New("unknown access log field")
 
-		// Call the next handler in the chain
-		next(ctx)
+// lookupInfoKey is the user value under which a lookup reports how it was
+// answered, for the access log.
+const lookupInfoKey = "lookupInfo"
+
+// accessLogFields are the fields an access line can have, and how to get them.
+var accessLogFields = map[string]func(ctx *fasthttp.RequestCtx, duration time.Duration) interface{}{
+	"method":   func(ctx *fasthttp.RequestCtx, _ time.Duration) interface{} { return string(ctx.Method()) },
+	"path":     func(ctx *fasthttp.RequestCtx, _ time.Duration) interface{} { return string(ctx.Path()) },
+	"uri":      func(ctx *fasthttp.RequestCtx, _ time.Duration) interface{} { return ctx.URI().String() },
+	"status":   func(ctx *fasthttp.RequestCtx, _ time.Duration) interface{} { return ctx.Response.StatusCode() },
+	"duration": func(_ *fasthttp.RequestCtx, duration time.Duration) interface{} { return duration.String() },
+	"bytes": func(ctx *fasthttp.RequestCtx, _ time.Duration) interface{} {
+		// A streamed body is only written once the handler returns
+		if ctx.Response.IsBodyStream() {
+			return nil
+		}
+		return len(ctx.Response.Body())
+	},
+	"country": func(ctx *fasthttp.RequestCtx, _ time.Duration) interface{} {
+		return string(ctx.QueryArgs().Peek("country_iso"))
+	},
+	"id": func(ctx *fasthttp.RequestCtx, _ time.Duration) interface{} {
+		return string(ctx.QueryArgs().Peek("id"))
+	},
+	"cache_hit": func(ctx *fasthttp.RequestCtx, _ time.Duration) interface{} {
+		if info := lookupInfoOf(ctx); info != nil {
+			return info.CacheHit
+		}
+		return nil
+	},
+	"upstream_latency": func(ctx *fasthttp.RequestCtx, _ time.Duration) interface{} {
+		if info := lookupInfoOf(ctx); info != nil && info.Upstream > 0 {
+			return info.Upstream.String()
+		}
+		return nil
+	},
+	"request_id":  func(ctx *fasthttp.RequestCtx, _ time.Duration) interface{} { return requestIDOf(ctx) },
+	"remote_addr": func(ctx *fasthttp.RequestCtx, _ time.Duration) interface{} { return ctx.RemoteAddr().String() },
+}
+
+func lookupInfoOf(ctx *fasthttp.RequestCtx) *client.LookupInfo {
+	info, _ := ctx.UserValue(lookupInfoKey).(*client.LookupInfo)
+	return info
+}
+
+// accessLog writes a line for every request served.
+type accessLog struct {
+	logger      *logrus.Logger
+	file        io.Closer
+	fields      []string
+	level       logrus.Level
+	sampleRatio float64
+}
+
+// newAccessLog returns the access log described by the configuration, writing
+// to its own file or else to the application logger.
+func newAccessLog(config models.LoggingConfig, debug bool, logger *logrus.Logger) (*accessLog, error) {
+	config = config.WithDefaults()
+	access := config.Access
+
+	for _, field := range access.Fields {
+		if _, ok := accessLogFields[field]; !ok {
+			return nil, fmt.Errorf("%w: %q", ErrUnknownLogField, field)
+		}
+	}
+	level, err := logrus.ParseLevel(access.Level)
+	if err != nil {
+		return nil, err
+	}
 
-		// Log information about the request using logrus
-		endTime := time.Now()
-		duration := endTime.Sub(startTime)
-		logrus.WithFields(logrus.Fields{
-			"Time":       endTime.Format("2006-01-02 15:04:05"),
-			"RemoteAddr": ctx.RemoteAddr(),
-			"Method":     string(ctx.Method()),
-			"RequestURI": ctx.URI().String(),
-			"Duration":   duration,
-		}).Info("Request handled")
+	if logger == nil {
+		logger = logrus.StandardLogger()
+	}
+	log := &accessLog{logger: logger, fields: access.Fields, level: level, sampleRatio: *access.SampleRatio}
+	if debug {
+		// Log every request in full while debugging
+		log.fields = append(append([]string(nil), log.fields...), "uri")
+		log.sampleRatio = 1
+	}
+	if access.FilePath == "" {
+		return log, nil
+	}
+
+	file, err := logging.NewRotatingFile(access.FilePath, int64(access.MaxSizeMB)<<20, access.MaxBackups)
+	if err != nil {
+		return nil, err
+	}
+	log.logger = logrus.New()
+	log.logger.SetOutput(file)
+	log.logger.SetFormatter(logger.Formatter)
+	log.logger.SetLevel(logger.GetLevel())
+	log.file = file
+	return log, nil
+}
+
+// write logs a served request, failures as warnings or errors and only a
+// sample of the successful requests.
+func (l *accessLog) write(ctx *fasthttp.RequestCtx, duration time.Duration) {
+	status := ctx.Response.StatusCode()
+	level := l.level
+	switch {
+	case status >= fasthttp.StatusInternalServerError:
+		level = logrus.ErrorLevel
+	case status >= fasthttp.StatusBadRequest:
+		level = logrus.WarnLevel
+	case l.sampleRatio < 1 && rand.Float64() >= l.sampleRatio:
+		return
+	}
+	if !l.logger.IsLevelEnabled(level) {
+		return
+	}
+
+	fields := make(logrus.Fields, len(l.fields))
+	for _, field := range l.fields {
+		if value := accessLogFields[field](ctx, duration); value != nil {
+			fields[field] = value
+		}
+	}
+	l.logger.WithFields(fields).Log(level, "Request handled")
+}
+
+// Close closes the file of the access log, if it has one.
+func (l *accessLog) Close() error {
+	if l == nil || l.file == nil {
+		return nil
+	}
+	return l.file.Close()
+}
+
+// LoggingMiddleware writes an access line for every request handled by next.
+func (cr *CustomRouter) LoggingMiddleware(next fasthttp.RequestHandler) fasthttp.RequestHandler {
+	return fasthttp.RequestHandler(func(ctx *fasthttp.RequestCtx) {
+		start := time.Now()
+		next(ctx)
+		if cr.accessLog != nil {
+			cr.accessLog.write(ctx, time.Since(start))
+		}
 	})
 }
@@ -0,0 +1,141 @@
+package api
+
+import (
+	"backendify/pkg/config"
+	"backendify/pkg/models"
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/valyala/fasthttp"
+)
+
+func newLoggedRouter(t *testing.T, logging models.LoggingConfig, debug bool) (*CustomRouter, *bytes.Buffer) {
+	var out bytes.Buffer
+	logger := logrus.New()
+	logger.SetOutput(&out)
+	logger.SetFormatter(&logrus.JSONFormatter{})
+
+	appConfig := models.Config{
+		Application: models.ApplicationConfig{MockFlag: true, DebugMode: debug},
+		Logging:     logging,
+	}
+	router, err := NewRouter(config.BackendConfig{"us": "http://localhost:9001"}, &appConfig, logger)
+	assert.NoError(t, err)
+	return router, &out
+}
+
+func accessLines(t *testing.T, out *bytes.Buffer) []map[string]interface{} {
+	var lines []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var fields map[string]interface{}
+		assert.NoError(t, json.Unmarshal([]byte(line), &fields))
+		if fields["msg"] == "Request handled" {
+			lines = append(lines, fields)
+		}
+	}
+	return lines
+}
+
+func serve(router *CustomRouter, uri string) {
+	ctx := newRequestCtx()
+	ctx.Request.SetRequestURI(uri)
+	ctx.Request.Header.SetMethod(fasthttp.MethodGet)
+	router.HandleRequest(ctx)
+}
+
+func TestAccessLog(t *testing.T) {
+	t.Run("Selected fields", func(t *testing.T) {
+		router, out := newLoggedRouter(t, models.LoggingConfig{
+			Access: models.AccessLogConfig{Fields: []string{"status", "country", "cache_hit", "request_id"}},
+		}, false)
+
+		serve(router, "/company?id=1&country_iso=us")
+
+		lines := accessLines(t, out)
+		if !assert.Len(t, lines, 1, "Expected a line per request") {
+			return
+		}
+		line := lines[0]
+		assert.Equal(t, "info", line["level"])
+		assert.Equal(t, float64(fasthttp.StatusOK), line["status"])
+		assert.Equal(t, "us", line["country"])
+		assert.Equal(t, false, line["cache_hit"], "Expected the lookup to report how it was answered")
+		assert.Contains(t, line, "request_id")
+		assert.NotContains(t, line, "uri", "Expected only the selected fields")
+	})
+
+	noSampling := 0.0
+	t.Run("Failures are always logged", func(t *testing.T) {
+		router, out := newLoggedRouter(t, models.LoggingConfig{
+			Access: models.AccessLogConfig{SampleRatio: &noSampling},
+		}, false)
+
+		for i := 0; i < 10; i++ {
+			serve(router, "/status")
+		}
+		serve(router, "/company?id=1&country_iso=xx")
+
+		lines := accessLines(t, out)
+		if !assert.Len(t, lines, 1, "Expected successful requests to be sampled out") {
+			return
+		}
+		assert.Equal(t, "warning", lines[0]["level"])
+		assert.Equal(t, float64(fasthttp.StatusNotFound), lines[0]["status"])
+	})
+
+	t.Run("Level", func(t *testing.T) {
+		router, out := newLoggedRouter(t, models.LoggingConfig{
+			Access: models.AccessLogConfig{Level: "debug"},
+		}, false)
+		serve(router, "/status")
+		assert.Empty(t, accessLines(t, out), "Expected debug lines to be filtered out")
+	})
+
+	t.Run("Debug mode", func(t *testing.T) {
+		router, out := newLoggedRouter(t, models.LoggingConfig{
+			Access: models.AccessLogConfig{Level: "debug", SampleRatio: &noSampling},
+		}, true)
+		router.Logger.SetLevel(logrus.DebugLevel)
+
+		serve(router, "/status?verbose")
+
+		lines := accessLines(t, out)
+		if !assert.Len(t, lines, 1, "Expected every request to be logged") {
+			return
+		}
+		assert.Equal(t, "http:///status?verbose", lines[0]["uri"], "Expected the full URI")
+	})
+
+	t.Run("File", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "access.log")
+		router, out := newLoggedRouter(t, models.LoggingConfig{
+			Access: models.AccessLogConfig{FilePath: path},
+		}, false)
+
+		serve(router, "/status")
+		router.ShutDown()
+
+		assert.Empty(t, accessLines(t, out), "Expected no access line in the application log")
+		content, err := os.ReadFile(path)
+		assert.NoError(t, err)
+		assert.Len(t, accessLines(t, bytes.NewBuffer(content)), 1)
+	})
+
+	t.Run("Unknown field", func(t *testing.T) {
+		appConfig := models.Config{
+			Application: models.ApplicationConfig{MockFlag: true},
+			Logging:     models.LoggingConfig{Access: models.AccessLogConfig{Fields: []string{"referer"}}},
+		}
+		_, err := NewRouter(config.BackendConfig{}, &appConfig, logrus.New())
+		assert.ErrorIs(t, err, ErrUnknownLogField)
+	})
+}
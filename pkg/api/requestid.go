@@ -0,0 +1,67 @@
+package api
+
+import (
+	"backendify/pkg/client"
+	"crypto/rand"
+	"encoding/hex"
+	"strconv"
+
+	"github.com/sirupsen/logrus"
+	"github.com/valyala/fasthttp"
+)
+
+// requestIDKey is the user value holding the id of a request.
+const requestIDKey = "requestID"
+
+// maxRequestIDLength bounds the incoming ids kept, longer ones are replaced.
+const maxRequestIDLength = 128
+
+// assignRequestID keeps the X-Request-ID of the caller, or generates one when
+// it is missing or unusable, and echoes it in the response.
+func assignRequestID(ctx *fasthttp.RequestCtx) string {
+	id := string(ctx.Request.Header.Peek(client.RequestIDHeader))
+	if !validRequestID(id) {
+		id = newRequestID()
+	}
+	ctx.SetUserValue(requestIDKey, id)
+	ctx.Response.Header.Set(client.RequestIDHeader, id)
+	return id
+}
+
+// validRequestID reports whether id is short and printable, so that it is
+// safe to log and to forward in a header.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < '!' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	var id [16]byte
+	rand.Read(id[:])
+	return hex.EncodeToString(id[:])
+}
+
+// requestIDOf returns the id of a request, falling back to the connection
+// sequence number for requests that did not go through the router.
+func requestIDOf(ctx *fasthttp.RequestCtx) string {
+	if id, ok := ctx.UserValue(requestIDKey).(string); ok {
+		return id
+	}
+	return strconv.FormatUint(ctx.ID(), 10)
+}
+
+// log returns the logger of a request, which tags its entries with the request id.
+func (cr *CustomRouter) log(requestID string) *logrus.Entry {
+	logger := cr.Logger
+	if logger == nil {
+		logger = logrus.StandardLogger()
+	}
+	return logger.WithField("request_id", requestID)
+}
@@ -0,0 +1,94 @@
+package api
+
+import (
+	"backendify/pkg/client"
+	"backendify/pkg/config"
+	"backendify/pkg/models"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/valyala/fasthttp"
+)
+
+func TestRequestID(t *testing.T) {
+	appConfig := models.Config{
+		Application: models.ApplicationConfig{MockFlag: true},
+	}
+	router, err := NewRouter(config.BackendConfig{"us": "http://localhost:9001"}, &appConfig, logrus.New())
+	assert.NoError(t, err)
+
+	post := func(uri, body, requestID string) *fasthttp.RequestCtx {
+		ctx := newRequestCtx()
+		ctx.Request.SetRequestURI(uri)
+		ctx.Request.Header.SetMethod(fasthttp.MethodPost)
+		ctx.Request.Header.Set(client.RequestIDHeader, requestID)
+		ctx.Request.SetBodyString(body)
+		router.HandleRequest(ctx)
+		return ctx
+	}
+
+	request := func(uri, requestID string) *fasthttp.RequestCtx {
+		ctx := newRequestCtx()
+		ctx.Request.SetRequestURI(uri)
+		ctx.Request.Header.SetMethod(fasthttp.MethodGet)
+		if requestID != "" {
+			ctx.Request.Header.Set(client.RequestIDHeader, requestID)
+		}
+		router.HandleRequest(ctx)
+		return ctx
+	}
+
+	t.Run("Incoming id", func(t *testing.T) {
+		ctx := request("/company?id=1&country_iso=xx", "abc-123")
+		assert.Equal(t, "abc-123", string(ctx.Response.Header.Peek(client.RequestIDHeader)), "Expected the id to be echoed")
+
+		var problem Problem
+		assert.NoError(t, json.Unmarshal(ctx.Response.Body(), &problem))
+		assert.Equal(t, "abc-123", problem.RequestID, "Expected the id in the error body")
+	})
+
+	t.Run("Generated id", func(t *testing.T) {
+		first := string(request("/status", "").Response.Header.Peek(client.RequestIDHeader))
+		second := string(request("/status", "").Response.Header.Peek(client.RequestIDHeader))
+		assert.Len(t, first, 32, "Expected an id to be generated")
+		assert.NotEqual(t, first, second, "Expected every request to get its own id")
+	})
+
+	t.Run("Invalid id", func(t *testing.T) {
+		for _, invalid := range []string{"with space", strings.Repeat("x", maxRequestIDLength+1)} {
+			id := string(request("/status", invalid).Response.Header.Peek(client.RequestIDHeader))
+			assert.NotEqual(t, invalid, id, "Expected %q to be replaced", invalid)
+			assert.Len(t, id, 32)
+		}
+	})
+	t.Run("Batch item errors", func(t *testing.T) {
+		ctx := post("/companies/batch", `{"items":[{"country_iso":"xx","id":"1"}]}`, "abc")
+
+		var response BatchResponse
+		assert.NoError(t, json.Unmarshal(ctx.Response.Body(), &response))
+		if assert.Len(t, response.Results, 1) && assert.NotNil(t, response.Results[0].Error) {
+			assert.Equal(t, "abc", response.Results[0].Error.RequestID)
+		}
+	})
+
+	t.Run("Stream item errors", func(t *testing.T) {
+		// An unknown country, an invalid item and a line too long to read
+		body := "{\"country_iso\":\"xx\",\"id\":\"1\"}\nnot json\n" + strings.Repeat("x", 100000) + "\n"
+		ctx := post("/companies/stream", body, "abc")
+
+		lines := strings.Split(strings.TrimSpace(string(ctx.Response.Body())), "\n")
+		if !assert.Len(t, lines, 3) {
+			return
+		}
+		for _, line := range lines {
+			var result BatchResult
+			assert.NoError(t, json.Unmarshal([]byte(line), &result))
+			if assert.NotNil(t, result.Error, "Expected an error for %s", line) {
+				assert.Equal(t, "abc", result.Error.RequestID)
+			}
+		}
+	})
+}
@@ -4,7 +4,10 @@ import (
 	"backendify/pkg/client"
 	"backendify/pkg/client/mocks"
 	"backendify/pkg/config"
+	"backendify/pkg/metrics"
 	"backendify/pkg/models"
+	"strings"
+	"time"
 
 	"github.com/sirupsen/logrus"
 	"github.com/valyala/fasthttp"
@@ -16,15 +19,45 @@ type CustomRouter struct {
 	Backends       config.BackendConfig
 	BackendClient  client.CompanyFetcher
 	Logger         *logrus.Logger
+	Upstream       models.UpstreamConfig
 	fetchSemaphore *semaphore.Weighted
+	limiter        *RateLimiter
+	batch          models.BatchConfig
+	getOnly        bool
+	metrics        *metrics.Registry
+	requestMetrics requestMetrics
+	accessLog      *accessLog
+}
+
+// routeMethods are the methods of the routes that take other requests than GET.
+var routeMethods = map[string]string{
+	"/companies/batch":  fasthttp.MethodPost,
+	"/companies/stream": fasthttp.MethodPost,
 }
 
 func NewRouter(backends config.BackendConfig, config *models.Config, logger *logrus.Logger) (*CustomRouter, error) {
+	limiter, err := NewRateLimiter(config.Limiter)
+	if err != nil {
+		return nil, err
+	}
+	accessLog, err := newAccessLog(config.Logging, config.Application.DebugMode, logger)
+	if err != nil {
+		return nil, err
+	}
+
 	r := &CustomRouter{
 		Backends:       backends,
 		Logger:         logger,
+		Upstream:       config.Upstream,
 		fetchSemaphore: semaphore.NewWeighted(100),
+		limiter:        limiter,
+		batch:          config.Application.Batch.WithDefaults(),
+		getOnly:        config.Server.GetOnly,
+		metrics:        metrics.NewRegistry(),
+		requestMetrics: newRequestMetrics(),
+		accessLog:      accessLog,
 	}
+	r.metrics.Register(r.requestMetrics.requests, r.requestMetrics.duration)
 
 	// if mock mode is on setup mock client
 	if config.Application.MockFlag {
@@ -33,27 +66,86 @@ func NewRouter(backends config.BackendConfig, config *models.Config, logger *log
 	}
 
 	// Create a new instance of BackendClient with worker pool support
-	newClient, err := client.NewBackendClient(config.Application.CacheSize, config.Application.Workers)
+	newClient, err := client.NewBackendClient(backends, config)
 	if err != nil {
 		return nil, err
 	}
 	newClient.StartWorkers()
 	r.BackendClient = newClient
+	r.metrics.Register(newClient.Collectors()...)
 
 	return r, nil
 }
 
 func (cr *CustomRouter) HandleRequest(ctx *fasthttp.RequestCtx) {
+	defer cr.observe(ctx, time.Now())
+	assignRequestID(ctx)
+
+	if !cr.methodAllowed(ctx) {
+		return
+	}
+
 	switch string(ctx.Path()) {
 	case "/status":
-		LoggingMiddleware(cr.Status)(ctx)
-	case "/company":
-		LoggingMiddleware(cr.GetCompany)(ctx)
+		cr.LoggingMiddleware(cr.Status)(ctx)
+	case "/company", "/v1/company", "/v2/company":
+		ctx.SetUserValue(versionKey, negotiateVersion(ctx))
+		cr.LoggingMiddleware(RateLimitMiddleware(cr.limiter, cr.GetCompany))(ctx)
+	case "/companies/batch":
+		ctx.SetUserValue(versionKey, negotiateVersion(ctx))
+		// The batch and stream handlers charge the rate limiter per item
+		cr.LoggingMiddleware(cr.GetCompanies)(ctx)
+	case "/companies/stream":
+		ctx.SetUserValue(versionKey, negotiateVersion(ctx))
+		cr.LoggingMiddleware(cr.StreamCompanies)(ctx)
+	case "/health/backends":
+		cr.LoggingMiddleware(cr.BackendHealth)(ctx)
+	case "/metrics":
+		cr.Metrics(ctx)
+	case "/debug/ratelimit":
+		cr.LoggingMiddleware(cr.RateLimitState)(ctx)
+	case "/debug/pool":
+		cr.LoggingMiddleware(cr.PoolStats)(ctx)
+	case "/debug/coalescing":
+		cr.LoggingMiddleware(cr.CoalescingStats)(ctx)
 	default:
-		ctx.Error("Not Found", fasthttp.StatusNotFound)
+		writeProblem(ctx, fasthttp.StatusNotFound, kindNoRoute, "no route for "+string(ctx.Path()))
+	}
+}
+
+// RequestConfig is the server's HeaderReceived hook. It gives the responses of
+// /companies/stream the stream write timeout, since the server write timeout
+// would cut off a stream whose lookups take longer than it.
+func (cr *CustomRouter) RequestConfig(header *fasthttp.RequestHeader) fasthttp.RequestConfig {
+	if path, _, _ := strings.Cut(string(header.RequestURI()), "?"); path == "/companies/stream" {
+		return fasthttp.RequestConfig{WriteTimeout: cr.batch.StreamWriteTimeout}
+	}
+	return fasthttp.RequestConfig{}
+}
+
+// methodAllowed rejects the requests with a method their route does not
+// take. Routes with a method of their own only take that one, the others
+// only take GET when the server is GET-only.
+func (cr *CustomRouter) methodAllowed(ctx *fasthttp.RequestCtx) bool {
+	method, ok := routeMethods[string(ctx.Path())]
+	if !ok {
+		if !cr.getOnly {
+			return true
+		}
+		method = fasthttp.MethodGet
+	}
+	if string(ctx.Method()) == method {
+		return true
 	}
+
+	ctx.Response.Header.Set(fasthttp.HeaderAllow, method)
+	writeProblem(ctx, fasthttp.StatusMethodNotAllowed, kindMethodNotAllowed, string(ctx.Method())+" is not allowed on "+string(ctx.Path()))
+	return false
 }
 
 func (cr *CustomRouter) ShutDown() {
 	cr.BackendClient.StopWorkers()
+	if err := cr.accessLog.Close(); err != nil {
+		cr.Logger.Error("Error closing access log: ", err)
+	}
 }
@@ -3,12 +3,23 @@ package api
 import (
 	"backendify/pkg/config"
 	"backendify/pkg/models"
+	"bytes"
+	"encoding/json"
 	"testing"
 
+	"github.com/prometheus/common/expfmt"
 	"github.com/stretchr/testify/assert"
 	"github.com/valyala/fasthttp"
 )
 
+// newRequestCtx returns a request context initialized as the server does,
+// so that it can serve as the context of a lookup.
+func newRequestCtx() *fasthttp.RequestCtx {
+	ctx := &fasthttp.RequestCtx{}
+	ctx.Init(&fasthttp.Request{}, nil, nil)
+	return ctx
+}
+
 func TestNewRouter(t *testing.T) {
 	// Create a sample BackendConfig
 	backends := config.BackendConfig{
@@ -31,7 +42,7 @@ func TestNewRouter(t *testing.T) {
 	assert.Nil(t, err)
 
 	// Create a sample fasthttp request for testing
-	ctx := &fasthttp.RequestCtx{}
+	ctx := newRequestCtx()
 	ctx.Request.SetRequestURI("/status")
 	ctx.Request.Header.SetMethod("GET")
 
@@ -44,3 +55,90 @@ func TestNewRouter(t *testing.T) {
 	// Check if the response status code is as expected (200 OK)
 	assert.Equal(t, fasthttp.StatusOK, resp.StatusCode())
 }
+
+func TestVerboseStatus(t *testing.T) {
+	appConfig := models.Config{
+		Application: models.ApplicationConfig{
+			MockFlag: true,
+		},
+	}
+	router, err := NewRouter(config.BackendConfig{"us": "http://localhost:9001"}, &appConfig, nil)
+	assert.Nil(t, err)
+
+	ctx := newRequestCtx()
+	ctx.Request.SetRequestURI("/status?verbose")
+	ctx.Request.Header.SetMethod("GET")
+	router.HandleRequest(ctx)
+
+	assert.Equal(t, fasthttp.StatusOK, ctx.Response.StatusCode())
+	assert.Equal(t, "application/json", string(ctx.Response.Header.ContentType()))
+	assert.Contains(t, string(ctx.Response.Body()), `"ready":true`)
+}
+
+func TestGetCompanyProblem(t *testing.T) {
+	appConfig := models.Config{
+		Application: models.ApplicationConfig{
+			MockFlag: true,
+		},
+	}
+	router, err := NewRouter(config.BackendConfig{"us": "http://localhost:9001"}, &appConfig, nil)
+	assert.Nil(t, err)
+
+	ctx := newRequestCtx()
+	ctx.Request.SetRequestURI("/company?id=1&country_iso=xx")
+	ctx.Request.Header.SetMethod("GET")
+	router.HandleRequest(ctx)
+
+	assert.Equal(t, fasthttp.StatusNotFound, ctx.Response.StatusCode())
+	assert.Equal(t, "application/problem+json", string(ctx.Response.Header.ContentType()))
+
+	var problem Problem
+	assert.NoError(t, json.Unmarshal(ctx.Response.Body(), &problem))
+	assert.Equal(t, "/problems/not_found", problem.Type)
+	assert.Equal(t, fasthttp.StatusNotFound, problem.Status)
+	assert.Equal(t, "xx", problem.Country)
+	assert.Equal(t, "1", problem.ID)
+	assert.NotEmpty(t, problem.RequestID)
+}
+
+func TestMetrics(t *testing.T) {
+	appConfig := models.Config{
+		Application: models.ApplicationConfig{
+			MockFlag: true,
+		},
+	}
+	router, err := NewRouter(config.BackendConfig{"us": "http://localhost:9001"}, &appConfig, nil)
+	assert.Nil(t, err)
+
+	ctx := newRequestCtx()
+	ctx.Request.SetRequestURI("/status")
+	router.HandleRequest(ctx)
+
+	ctx = newRequestCtx()
+	ctx.Request.SetRequestURI("/metrics")
+	router.HandleRequest(ctx)
+
+	assert.Equal(t, fasthttp.StatusOK, ctx.Response.StatusCode())
+	assert.Contains(t, string(ctx.Response.Header.ContentType()), "text/plain; version=0.0.4")
+	assert.Contains(t, string(ctx.Response.Body()), `backendify_http_requests_total{route="/status",status="200",country=""} 1`)
+
+	var parser expfmt.TextParser
+	_, err = parser.TextToMetricFamilies(bytes.NewReader(ctx.Response.Body()))
+	assert.NoError(t, err, "Expected the exposition to parse")
+
+	// The backend client adds its own metrics
+	appConfig.Application = models.ApplicationConfig{CacheSize: 10}
+	router, err = NewRouter(config.BackendConfig{"us": "http://localhost:9001"}, &appConfig, nil)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer router.ShutDown()
+
+	ctx = newRequestCtx()
+	ctx.Request.SetRequestURI("/metrics")
+	router.HandleRequest(ctx)
+
+	families, err := parser.TextToMetricFamilies(bytes.NewReader(ctx.Response.Body()))
+	assert.NoError(t, err, "Expected the exposition to parse")
+	assert.Greater(t, len(families), 2, "Expected the backend client metrics")
+}
@@ -0,0 +1,135 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"strconv"
+	"sync"
+
+	"github.com/valyala/fasthttp"
+)
+
+// StreamCompanies looks up the companies listed as newline-delimited JSON
+// items in the request body, and streams every result back as a line of
+// NDJSON as soon as its lookup completes, so results come in completion
+// order rather than request order.
+//
+// A bounded number of lookups is in flight at once and a lookup only frees
+// its slot once its result is written, so a slow reader slows the lookups
+// down instead of piling results up in memory. The request body is read in
+// full, within the server body size limit, before the first lookup starts.
+// The response is written under the stream write timeout rather than the
+// server one, see RequestConfig.
+func (cr *CustomRouter) StreamCompanies(ctx *fasthttp.RequestCtx) {
+	// The request is reused once the handler returns, before the stream is written
+	body := append([]byte(nil), ctx.PostBody()...)
+	if !cr.chargeItems(ctx, countItems(body)) {
+		return
+	}
+	version := versionOf(ctx)
+	requestID := requestIDOf(ctx)
+	// The span lasts until the stream is written, after the handler returns
+	traceCtx, span := startRequestSpan(ctx)
+	span.SetAttribute("status", strconv.Itoa(fasthttp.StatusOK))
+
+	ctx.SetContentType("application/x-ndjson")
+	ctx.SetStatusCode(fasthttp.StatusOK)
+	ctx.SetBodyStreamWriter(func(w *bufio.Writer) {
+		defer span.End()
+		streamCtx, cancel := context.WithCancel(traceCtx)
+		defer cancel()
+
+		results := make(chan BatchResult)
+		go cr.dispatch(streamCtx, body, version, requestID, results)
+
+		encoder := json.NewEncoder(w)
+		for result := range results {
+			err := encoder.Encode(result)
+			if err == nil {
+				err = w.Flush()
+			}
+			if err != nil {
+				// The client went away, stop looking companies up for it, including
+				// the lookups in flight
+				cr.log(requestID).Warn("Stopping company stream: client disconnected")
+				span.SetError(err)
+				cancel()
+				break
+			}
+		}
+	})
+}
+
+// countItems counts the non-blank lines of an NDJSON body.
+func countItems(body []byte) int {
+	items := 0
+	for len(body) > 0 {
+		var line []byte
+		line, body, _ = bytes.Cut(body, []byte("\n"))
+		if len(bytes.TrimSpace(line)) > 0 {
+			items++
+		}
+	}
+	return items
+}
+
+// dispatch looks up the items of an NDJSON body, a bounded number at a time,
+// and sends their results until the body is exhausted or ctx is cancelled.
+func (cr *CustomRouter) dispatch(ctx context.Context, body []byte, version apiVersion, requestID string, results chan<- BatchResult) {
+	defer close(results)
+
+	slots := make(chan struct{}, cr.batch.Concurrency)
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	send := func(result BatchResult) {
+		select {
+		case results <- result:
+		case <-ctx.Done():
+		}
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+
+		var item BatchItem
+		if err := json.Unmarshal(line, &item); err != nil {
+			problem := newProblem(fasthttp.StatusBadRequest, kindInvalidRequest, "invalid item: "+err.Error(), version)
+			problem.RequestID = requestID
+			send(BatchResult{Status: fasthttp.StatusBadRequest, Error: &problem})
+			continue
+		}
+
+		// select picks at random when both a slot is free and ctx is done, so
+		// ctx is checked on both sides of taking a slot
+		if ctx.Err() != nil {
+			return
+		}
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+			return
+		}
+		if ctx.Err() != nil {
+			<-slots
+			return
+		}
+		wg.Add(1)
+		go func(item BatchItem) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			send(cr.lookupItem(ctx, item, version, requestID))
+		}(item)
+	}
+	if err := scanner.Err(); err != nil {
+		problem := newProblem(fasthttp.StatusBadRequest, kindInvalidRequest, "invalid body: "+err.Error(), version)
+		problem.RequestID = requestID
+		send(BatchResult{Status: fasthttp.StatusBadRequest, Error: &problem})
+	}
+}
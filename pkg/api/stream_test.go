@@ -0,0 +1,159 @@
+package api
+
+import (
+	"backendify/pkg/client/mocks"
+	"backendify/pkg/config"
+	"backendify/pkg/models"
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/valyala/fasthttp"
+)
+
+func TestStreamCompanies(t *testing.T) {
+	appConfig := models.Config{
+		Application: models.ApplicationConfig{
+			MockFlag: true,
+			Batch:    models.BatchConfig{Concurrency: 2},
+		},
+	}
+	router, err := NewRouter(config.BackendConfig{"us": "http://localhost:9001"}, &appConfig, logrus.New())
+	assert.Nil(t, err)
+
+	ctx := newRequestCtx()
+	ctx.Request.Header.SetMethod("POST")
+	ctx.Request.SetRequestURI("/companies/stream")
+	ctx.Request.SetBodyString("{\"country_iso\":\"us\",\"id\":\"1\"}\n\n{\"country_iso\":\"xx\",\"id\":\"2\"}\nnot json\n{\"country_iso\":\"us\",\"id\":\"3\"}\n")
+	router.HandleRequest(ctx)
+
+	assert.Equal(t, fasthttp.StatusOK, ctx.Response.StatusCode())
+	assert.Equal(t, "application/x-ndjson", string(ctx.Response.Header.ContentType()))
+
+	statuses := map[int]int{}
+	scanner := bufio.NewScanner(bytes.NewReader(ctx.Response.Body()))
+	for scanner.Scan() {
+		var result BatchResult
+		assert.NoError(t, json.Unmarshal(scanner.Bytes(), &result))
+		statuses[result.Status]++
+	}
+	assert.Equal(t, map[int]int{
+		fasthttp.StatusOK:         2,
+		fasthttp.StatusNotFound:   1,
+		fasthttp.StatusBadRequest: 1,
+	}, statuses)
+}
+
+// slowClient answers every lookup after a delay, a long one for the "slow"
+// company, unless it is abandoned first.
+type slowClient struct {
+	mocks.MockBackendClient
+	calls     *atomic.Int64
+	abandoned *atomic.Int64
+}
+
+func (c slowClient) FetchCompanyData(ctx context.Context, country, id string) (*models.Company, error) {
+	c.calls.Add(1)
+	delay := 20 * time.Millisecond
+	if id == "slow" {
+		delay = time.Minute
+	}
+	select {
+	case <-time.After(delay):
+		return &models.Company{ID: id, Name: "Company A", Active: true}, nil
+	case <-ctx.Done():
+		c.abandoned.Add(1)
+		return nil, ctx.Err()
+	}
+}
+
+func TestStreamCompaniesDisconnect(t *testing.T) {
+	appConfig := models.Config{
+		Application: models.ApplicationConfig{
+			MockFlag: true,
+			Batch:    models.BatchConfig{Concurrency: 2},
+		},
+		Upstream: models.UpstreamConfig{RequestTimeout: time.Minute},
+	}
+	router, err := NewRouter(config.BackendConfig{"us": "http://localhost:9001"}, &appConfig, logrus.New())
+	assert.Nil(t, err)
+	fetcher := slowClient{calls: new(atomic.Int64), abandoned: new(atomic.Int64)}
+	router.BackendClient = fetcher
+
+	// The slow lookup stays in flight until the client goes away
+	var body strings.Builder
+	body.WriteString(`{"country_iso":"us","id":"slow"}` + "\n")
+	for i := 0; i < 100; i++ {
+		body.WriteString(`{"country_iso":"us","id":"1"}` + "\n")
+	}
+
+	ctx := newRequestCtx()
+	ctx.Request.Header.SetMethod("POST")
+	ctx.Request.SetRequestURI("/companies/stream")
+	ctx.Request.SetBodyString(body.String())
+	router.HandleRequest(ctx)
+
+	// Read the first result, then go away
+	stream := ctx.Response.BodyStream()
+	line, err := bufio.NewReader(stream).ReadString('\n')
+	assert.NoError(t, err)
+	assert.Contains(t, line, `"status":200`)
+	stream.(io.Closer).Close()
+
+	// The next result written finds the client gone
+	assert.Eventually(t, func() bool { return fetcher.abandoned.Load() > 0 },
+		time.Second, 5*time.Millisecond, "Expected the lookups in flight to be abandoned")
+	calls := fetcher.calls.Load()
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, calls, fetcher.calls.Load(), "Expected no lookup after the client went away")
+	assert.Less(t, calls, int64(20))
+}
+
+func TestStreamCompaniesWriteTimeout(t *testing.T) {
+	appConfig := models.Config{
+		Application: models.ApplicationConfig{
+			MockFlag: true,
+			Batch:    models.BatchConfig{Concurrency: 1, StreamWriteTimeout: 5 * time.Second},
+		},
+		Upstream: models.UpstreamConfig{RequestTimeout: time.Minute},
+	}
+	router, err := NewRouter(config.BackendConfig{"us": "http://localhost:9001"}, &appConfig, logrus.New())
+	assert.Nil(t, err)
+	router.BackendClient = slowClient{calls: new(atomic.Int64), abandoned: new(atomic.Int64)}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if !assert.NoError(t, err) {
+		return
+	}
+	// The stream takes several times the server write timeout
+	server := &fasthttp.Server{
+		Handler:        router.HandleRequest,
+		HeaderReceived: router.RequestConfig,
+		WriteTimeout:   50 * time.Millisecond,
+	}
+	go server.Serve(listener)
+	defer server.Shutdown()
+
+	const items = 10
+	req := fasthttp.AcquireRequest()
+	defer fasthttp.ReleaseRequest(req)
+	resp := fasthttp.AcquireResponse()
+	defer fasthttp.ReleaseResponse(resp)
+	req.Header.SetMethod(fasthttp.MethodPost)
+	req.SetRequestURI("http://" + listener.Addr().String() + "/companies/stream")
+	req.SetBodyString(strings.Repeat(`{"country_iso":"us","id":"1"}`+"\n", items))
+	if !assert.NoError(t, fasthttp.Do(req, resp)) {
+		return
+	}
+
+	assert.Equal(t, items, bytes.Count(resp.Body(), []byte(`"status":200`)), "Expected every result of the stream")
+}
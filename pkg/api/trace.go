@@ -0,0 +1,48 @@
+package api
+
+import (
+	"backendify/pkg/tracing"
+	"context"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+// startRequestSpan starts the server span of a request, continuing the trace
+// of the caller if it sent a traceparent header. The returned context carries
+// the span, for the spans of the stages of the request, and derives from the
+// request so that the server shutting down cancels the lookups.
+func startRequestSpan(ctx *fasthttp.RequestCtx) (context.Context, *tracing.Span) {
+	remote, _ := tracing.ParseTraceparent(string(ctx.Request.Header.Peek(tracing.TraceparentHeader)))
+	traceCtx, span := tracing.StartKind(tracing.ContextWithRemote(requestContext(ctx), remote),
+		string(ctx.Method())+" "+string(ctx.Path()), tracing.SpanKindServer)
+	span.SetAttribute("request_id", requestIDOf(ctx))
+	return traceCtx, span
+}
+
+// requestContext returns a context that is done when ctx is, that is when the
+// server shuts down. Contexts derived from ctx itself would keep reading it
+// after the handler returns, when the server reuses it for another request.
+func requestContext(ctx *fasthttp.RequestCtx) context.Context {
+	return serverContext{done: ctx.Done()}
+}
+
+// serverContext is the cancellation of a request, without the request.
+type serverContext struct {
+	done <-chan struct{}
+}
+
+func (serverContext) Deadline() (time.Time, bool) { return time.Time{}, false }
+
+func (c serverContext) Done() <-chan struct{} { return c.done }
+
+func (c serverContext) Err() error {
+	select {
+	case <-c.done:
+		return context.Canceled
+	default:
+		return nil
+	}
+}
+
+func (serverContext) Value(key any) any { return nil }
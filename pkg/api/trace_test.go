@@ -0,0 +1,105 @@
+package api
+
+import (
+	"backendify/pkg/config"
+	"backendify/pkg/models"
+	"backendify/pkg/tracing"
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/valyala/fasthttp"
+	"github.com/valyala/fasthttp/fasthttputil"
+)
+
+func TestRequestSpans(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "spans.jsonl")
+	tracer, err := tracing.NewTracer(models.TracingConfig{Enabled: true, Exporter: tracing.ExporterFile, FilePath: path}, nil)
+	if !assert.NoError(t, err) {
+		return
+	}
+	tracing.SetTracer(tracer)
+	defer tracing.SetTracer(nil)
+
+	appConfig := models.Config{
+		Application: models.ApplicationConfig{MockFlag: true},
+	}
+	router, err := NewRouter(config.BackendConfig{"us": "http://localhost:9001"}, &appConfig, logrus.New())
+	assert.Nil(t, err)
+
+	const traceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	for _, route := range []struct{ method, uri, body string }{
+		{fasthttp.MethodGet, "/company?id=1&country_iso=us", ""},
+		{fasthttp.MethodPost, "/companies/batch", `{"items":[{"country_iso":"us","id":"1"}]}`},
+		{fasthttp.MethodPost, "/companies/stream", `{"country_iso":"us","id":"1"}`},
+	} {
+		ctx := newRequestCtx()
+		ctx.Request.Header.SetMethod(route.method)
+		ctx.Request.SetRequestURI(route.uri)
+		ctx.Request.Header.Set(tracing.TraceparentHeader, traceparent)
+		ctx.Request.SetBodyString(route.body)
+		router.HandleRequest(ctx)
+		// Write the stream, which ends its span
+		ctx.Response.Body()
+	}
+	assert.NoError(t, tracer.Shutdown())
+
+	file, err := os.Open(path)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer file.Close()
+
+	servers := map[string]tracing.SpanData{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var span tracing.SpanData
+		assert.NoError(t, json.Unmarshal(scanner.Bytes(), &span))
+		if span.Kind == tracing.SpanKindServer {
+			servers[span.Name] = span
+		}
+	}
+	for _, name := range []string{"GET /company", "POST /companies/batch", "POST /companies/stream"} {
+		span, ok := servers[name]
+		if !assert.True(t, ok, "Expected a server span for %s", name) {
+			continue
+		}
+		assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", span.TraceID, "Expected %s to continue the trace of the caller", name)
+		assert.Equal(t, "00f067aa0ba902b7", span.ParentSpanID)
+	}
+}
+
+func TestRequestSpanContext(t *testing.T) {
+	contexts := make(chan context.Context, 1)
+	listener := fasthttputil.NewInmemoryListener()
+	server := &fasthttp.Server{Handler: func(ctx *fasthttp.RequestCtx) {
+		traceCtx, span := startRequestSpan(ctx)
+		span.End()
+		contexts <- traceCtx
+	}}
+	go server.Serve(listener)
+
+	conn, err := listener.Dial()
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer conn.Close()
+	_, err = conn.Write([]byte("GET /company HTTP/1.1\r\nHost: test\r\n\r\n"))
+	assert.NoError(t, err)
+
+	traceCtx := <-contexts
+	assert.NoError(t, traceCtx.Err())
+	assert.NoError(t, server.Shutdown())
+	select {
+	case <-traceCtx.Done():
+		assert.ErrorIs(t, traceCtx.Err(), context.Canceled)
+	case <-time.After(time.Second):
+		t.Error("Expected the server shutting down to cancel the request context")
+	}
+}
@@ -0,0 +1,76 @@
+package api
+
+import (
+	"mime"
+	"strings"
+
+	"github.com/valyala/fasthttp"
+)
+
+// apiVersion is a version of the public API. v1 is the original response
+// shape, v2 returns the detailed company and richer errors.
+type apiVersion int
+
+const (
+	apiV1 apiVersion = 1
+	apiV2 apiVersion = 2
+)
+
+const versionKey = "apiVersion"
+
+// Media types selecting a version through the Accept header, besides a
+// version parameter on any media type, as in "application/json; version=2".
+var versionMediaTypes = map[string]apiVersion{
+	"application/vnd.backendify.v1+json": apiV1,
+	"application/vnd.backendify.v2+json": apiV2,
+}
+
+// negotiateVersion returns the API version of a request: the version in its
+// path, else the one asked for in its Accept header or version query
+// argument, else v1. The responses of unversioned paths are marked as
+// varying with the Accept header, successful or not.
+func negotiateVersion(ctx *fasthttp.RequestCtx) apiVersion {
+	switch {
+	case strings.HasPrefix(string(ctx.Path()), "/v1/"):
+		return apiV1
+	case strings.HasPrefix(string(ctx.Path()), "/v2/"):
+		return apiV2
+	}
+	ctx.Response.Header.Set(fasthttp.HeaderVary, fasthttp.HeaderAccept)
+
+	for _, accepted := range strings.Split(string(ctx.Request.Header.Peek(fasthttp.HeaderAccept)), ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(accepted))
+		if err != nil {
+			continue
+		}
+		if version, ok := versionMediaTypes[mediaType]; ok {
+			return version
+		}
+		if version, ok := parseVersion(params["version"]); ok {
+			return version
+		}
+	}
+
+	if version, ok := parseVersion(string(ctx.QueryArgs().Peek("version"))); ok {
+		return version
+	}
+	return apiV1
+}
+
+func parseVersion(s string) (apiVersion, bool) {
+	switch strings.TrimPrefix(s, "v") {
+	case "1":
+		return apiV1, true
+	case "2":
+		return apiV2, true
+	}
+	return 0, false
+}
+
+// versionOf returns the API version negotiated for a request by the router.
+func versionOf(ctx *fasthttp.RequestCtx) apiVersion {
+	if version, ok := ctx.UserValue(versionKey).(apiVersion); ok {
+		return version
+	}
+	return apiV1
+}
@@ -0,0 +1,92 @@
+package api
+
+import (
+	"backendify/pkg/config"
+	"backendify/pkg/models"
+	"encoding/json"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/valyala/fasthttp"
+)
+
+func TestNegotiateVersion(t *testing.T) {
+	tests := []struct {
+		name   string
+		uri    string
+		accept string
+		want   apiVersion
+	}{
+		{"Default", "/company", "", apiV1},
+		{"Path v1", "/v1/company", "application/vnd.backendify.v2+json", apiV1},
+		{"Path v2", "/v2/company", "", apiV2},
+		{"Vendor media type", "/company", "text/html, application/vnd.backendify.v2+json", apiV2},
+		{"Version parameter", "/company", "application/json; version=2", apiV2},
+		{"Query argument", "/company?version=2", "application/json", apiV2},
+		{"Unknown version", "/company", "application/json; version=9", apiV1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := newRequestCtx()
+			ctx.Request.SetRequestURI(tt.uri)
+			if tt.accept != "" {
+				ctx.Request.Header.Set(fasthttp.HeaderAccept, tt.accept)
+			}
+			assert.Equal(t, tt.want, negotiateVersion(ctx))
+		})
+	}
+}
+
+func TestVersionedRoutes(t *testing.T) {
+	appConfig := models.Config{
+		Application: models.ApplicationConfig{
+			MockFlag: true,
+		},
+	}
+	router, err := NewRouter(config.BackendConfig{"us": "http://localhost:9001"}, &appConfig, logrus.New())
+	assert.Nil(t, err)
+
+	get := func(uri string) *fasthttp.RequestCtx {
+		ctx := newRequestCtx()
+		ctx.Request.Header.SetMethod("GET")
+		ctx.Request.SetRequestURI(uri)
+		router.HandleRequest(ctx)
+		return ctx
+	}
+
+	t.Run("v1 keeps the original shape", func(t *testing.T) {
+		ctx := get("/v1/company?id=1&country_iso=us")
+		assert.Equal(t, fasthttp.StatusOK, ctx.Response.StatusCode())
+		assert.NotContains(t, string(ctx.Response.Body()), "fetched_at")
+
+		ctx = get("/v1/company?id=1&country_iso=xx")
+		assert.NotContains(t, string(ctx.Response.Body()), `"code"`)
+	})
+
+	t.Run("v2 returns details and structured errors", func(t *testing.T) {
+		ctx := get("/v2/company?id=1&country_iso=us")
+		assert.Equal(t, fasthttp.StatusOK, ctx.Response.StatusCode())
+		assert.Contains(t, string(ctx.Response.Body()), `"fetched_at"`)
+
+		ctx = get("/v2/company?id=1&country_iso=xx")
+		assert.Equal(t, fasthttp.StatusNotFound, ctx.Response.StatusCode())
+		var problem Problem
+		assert.NoError(t, json.Unmarshal(ctx.Response.Body(), &problem))
+		assert.Equal(t, "not_found", string(problem.Code))
+		if assert.NotNil(t, problem.Retryable) {
+			assert.False(t, *problem.Retryable)
+		}
+	})
+	t.Run("Only unversioned paths vary with Accept", func(t *testing.T) {
+		for uri, vary := range map[string]string{
+			"/company?id=1&country_iso=us":    fasthttp.HeaderAccept,
+			"/company?id=1&country_iso=xx":    fasthttp.HeaderAccept,
+			"/v1/company?id=1&country_iso=us": "",
+			"/v2/company?id=1&country_iso=xx": "",
+		} {
+			ctx := get(uri)
+			assert.Equal(t, vary, string(ctx.Response.Header.Peek(fasthttp.HeaderVary)), "Unexpected Vary header on %s", uri)
+		}
+	})
+}
@@ -0,0 +1,111 @@
+package client
+
+import (
+	"backendify/pkg/models"
+	"math"
+	"time"
+)
+
+// poolSample is the load observed on the worker pool over an autoscaling interval.
+type poolSample struct {
+	size      int
+	queued    int
+	completed int64
+	busyTime  time.Duration
+	queueWait time.Duration
+}
+
+// demand is the average number of busy workers over the interval, which by
+// Little's law is the number of workers needed to keep up with the load.
+func (s poolSample) demand(interval time.Duration) int {
+	return int(math.Ceil(float64(s.busyTime) / float64(interval)))
+}
+
+// averageWait is the average time the requests taken in the interval waited for a worker.
+func (s poolSample) averageWait() time.Duration {
+	if s.completed == 0 {
+		return 0
+	}
+	return s.queueWait / time.Duration(s.completed)
+}
+
+// desiredWorkers is the pool size for the observed load. The pool grows as
+// soon as requests wait for a worker, and shrinks by a single worker per
+// interval so that a short lull does not tear it down.
+func desiredWorkers(s poolSample, config models.AutoscaleConfig) int {
+	target := s.size
+	demand := s.demand(config.Interval)
+	switch {
+	case s.queued > 0 || s.averageWait() > config.TargetQueueWait:
+		grow := s.queued
+		if grow < 1 {
+			grow = 1
+		}
+		target = s.size + grow
+		if demand > target {
+			target = demand
+		}
+	case demand < s.size-1:
+		target = s.size - 1
+	}
+
+	if target < config.MinWorkers {
+		target = config.MinWorkers
+	}
+	if target > config.MaxWorkers {
+		target = config.MaxWorkers
+	}
+	return target
+}
+
+// runAutoscaler resizes the pool at the configured interval until stop is closed.
+func (bc *BackendClient) runAutoscaler(stop <-chan struct{}) {
+	defer bc.wg.Done()
+
+	ticker := time.NewTicker(bc.autoscale.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			bc.resize(desiredWorkers(bc.sample(), bc.autoscale))
+		case <-stop:
+			return
+		}
+	}
+}
+
+// sample collects the load observed since the previous sample.
+func (bc *BackendClient) sample() poolSample {
+	s := poolSample{
+		size:      int(bc.pool.size.Load()),
+		queued:    int(bc.pool.queued.Load()),
+		completed: bc.pool.completed.Swap(0),
+		busyTime:  time.Duration(bc.pool.busyTime.Swap(0)),
+		queueWait: time.Duration(bc.pool.queueWait.Swap(0)),
+	}
+	bc.pool.lastWait.Store(int64(s.averageWait()))
+	if s.completed > 0 {
+		bc.pool.lastLatency.Store(int64(s.busyTime) / s.completed)
+	} else {
+		bc.pool.lastLatency.Store(0)
+	}
+	return s
+}
+
+// resize starts or retires workers until the pool has the target size.
+// Only idle workers retire, so a shrinking pool never drops a request.
+func (bc *BackendClient) resize(target int) {
+	size := int(bc.pool.size.Load())
+	for ; size < target; size++ {
+		bc.startWorker()
+	}
+	for ; size > target; size-- {
+		select {
+		case bc.retire <- struct{}{}:
+		default:
+			// Every worker is busy, try again on the next interval
+			return
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package client
+
+import (
+	"backendify/pkg/models"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDesiredWorkers(t *testing.T) {
+	config := models.AutoscaleConfig{Enabled: true, MinWorkers: 2, MaxWorkers: 10}.WithDefaults(0)
+
+	tests := []struct {
+		name   string
+		sample poolSample
+		want   int
+	}{
+		{"Idle pool stays at its minimum", poolSample{size: 2}, 2},
+		{"Queued requests grow the pool", poolSample{size: 2, queued: 3}, 5},
+		{"Slow queue waits grow the pool", poolSample{size: 4, completed: 10, queueWait: time.Second}, 5},
+		{"Busy workers set the floor when growing", poolSample{size: 2, queued: 1, busyTime: 6 * time.Second}, 6},
+		{"Growth is capped", poolSample{size: 8, queued: 50}, 10},
+		{"Quiet pool shrinks by one", poolSample{size: 6, busyTime: time.Second}, 5},
+		{"Loaded pool keeps its size", poolSample{size: 6, busyTime: 5500 * time.Millisecond}, 6},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, desiredWorkers(tt.sample, config))
+		})
+	}
+}
+
+func TestAutoscaling(t *testing.T) {
+	release := make(chan struct{})
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		w.Header().Set("Content-Type", "application/x-company-v1")
+		w.Write([]byte(`{"cn":"Company Name","created_on":"2023-01-01T00:00:00Z"}`))
+	}))
+	defer backend.Close()
+
+	config := &models.Config{
+		Application: models.ApplicationConfig{
+			CacheSize: 100,
+			Autoscale: models.AutoscaleConfig{
+				Enabled:    true,
+				MinWorkers: 1,
+				MaxWorkers: 4,
+				Interval:   10 * time.Millisecond,
+			},
+		},
+	}
+	bc, err := NewBackendClient(map[string]string{"us": backend.URL}, config)
+	assert.NoError(t, err)
+	bc.StartWorkers()
+	defer bc.StopWorkers()
+
+	assert.Equal(t, int64(1), bc.Stats().Pool.Size)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 6; i++ {
+		wg.Add(1)
+		go func(id string) {
+			defer wg.Done()
+			bc.FetchCompanyData(context.Background(), "us", id)
+		}(strconv.Itoa(i))
+	}
+
+	assert.Eventually(t, func() bool {
+		return bc.Stats().Pool.Size == 4
+	}, time.Second, 5*time.Millisecond, "Expected the pool to grow to its maximum")
+
+	close(release)
+	wg.Wait()
+
+	assert.Eventually(t, func() bool {
+		return bc.Stats().Pool.Size == 1
+	}, time.Second, 5*time.Millisecond, "Expected the pool to shrink back to its minimum")
+	stats := bc.Stats().Pool
+	assert.True(t, stats.Autoscaling)
+	assert.Equal(t, int64(1), stats.MinSize)
+	assert.Equal(t, int64(4), stats.MaxSize)
+}
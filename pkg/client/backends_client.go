@@ -1,161 +1,520 @@
 package client
 
 import (
+	"backendify/pkg/config"
 	"backendify/pkg/models"
-	"encoding/json"
+	"backendify/pkg/tracing"
+	"context"
 	"errors"
-	"strings"
+	"fmt"
+	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
-	lru "github.com/hashicorp/golang-lru"
 	"github.com/valyala/fasthttp"
 )
 
 // CompanyFetcher is an interface for fetching company data.
 type CompanyFetcher interface {
-	FetchCompanyData(backendURL, id string) (*models.Company, error)
+	FetchCompanyData(ctx context.Context, country, id string) (*models.Company, error)
 	StartWorkers()
 	StopWorkers()
 	WorkersAvailable() bool
+	Stats() Stats
+	Health() HealthReport
 }
 
 type BackendClient struct {
-	httpClient       *fasthttp.Client
-	requestPool      sync.Pool
-	cache            *lru.Cache
-	requests         chan requestInfo
-	workers          int
-	availableWorkers int
-	wg               sync.WaitGroup
+	httpClient      *fasthttp.Client
+	requestPool     *sync.Pool
+	cache           *companyCache
+	cacheMode       string
+	refreshing      sync.Map
+	inflightMu      sync.Mutex
+	inflight        map[string]*sharedCall
+	coalescing      coalescingCounters
+	replicas        map[string]*replicaSet
+	breakers        map[string]*circuitBreaker
+	decoders        *DecoderRegistry
+	hedging         models.HedgingConfig
+	upstreamMetrics upstreamMetrics
+	latencies       sync.Map
+	upstream        models.UpstreamConfig
+	queues          [priorityLevels]chan requestInfo
+	queueDepth      int64
+	queueWait       time.Duration
+	workers         int
+	autoscale       models.AutoscaleConfig
+	pool            poolCounters
+	retire          chan struct{}
+	stop            chan struct{}
+	wg              sync.WaitGroup
 }
 
 type requestInfo struct {
-	backendURL string
+	ctx        context.Context
+	country    string
 	id         string
-	result     chan<- *models.Company
+	result     chan<- fetchResult
+	state      *atomic.Int32
+	enqueuedAt time.Time
+	queueSpan  *tracing.Span
+}
+
+type fetchResult struct {
+	company *models.Company
+	info    LookupInfo
+	err     error
+}
+
+// RequestIDHeader is the header carrying the id a request is correlated by,
+// forwarded to the backends.
+const RequestIDHeader = "X-Request-ID"
+
+type requestIDKey struct{}
+
+// WithRequestID returns a context whose lookups forward id to the backend.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+func requestIDFrom(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// LookupInfo describes how a lookup was answered, for the access log.
+type LookupInfo struct {
+	// CacheHit is set when the company came from the cache
+	CacheHit bool
+	// Upstream is the time spent calling the country backend, zero on a cache hit
+	Upstream time.Duration
+	// Coalesced is set when the lookup shared the request of a concurrent one
+	Coalesced bool
+}
+
+type lookupInfoKey struct{}
+
+// WithLookupInfo returns a context whose lookup reports how it was answered into info.
+func WithLookupInfo(ctx context.Context, info *LookupInfo) context.Context {
+	return context.WithValue(ctx, lookupInfoKey{}, info)
+}
+
+func lookupInfoFrom(ctx context.Context) *LookupInfo {
+	info, _ := ctx.Value(lookupInfoKey{}).(*LookupInfo)
+	return info
+}
+
+// sharedCall is a lookup shared between concurrent callers. It is cancelled
+// once every caller stopped waiting for it, so that a lookup nobody waits
+// for does not hold on to a worker.
+type sharedCall struct {
+	done    chan struct{}
+	cancel  context.CancelFunc
+	waiters int
+	// deadline is the deadline of the caller that started the lookup, if any
+	deadline    time.Time
+	hasDeadline bool
+
+	// Set before done is closed
+	company *models.Company
+	info    LookupInfo
+	err     error
 }
 
 var (
 	ErrCacheMiss       = errors.New("cache miss")
 	ErrInvalidResponse = errors.New("invalid response")
+	ErrTimeout         = errors.New("upstream request timed out")
+	ErrNotFound        = errors.New("company not found")
+	ErrUnknownBackend  = errors.New("no backend configured for country")
+	ErrUnknownMode     = errors.New("unknown cache mode")
+	ErrCircuitOpen     = errors.New("circuit breaker is open")
+	ErrOverloaded      = errors.New("worker pool is overloaded")
+	ErrPoolStopped     = errors.New("worker pool is stopped")
+	ErrBadPayload      = errors.New("malformed company payload")
 )
 
-// NewBackendClient initializes a new BackendClient with the given cache size and worker count.
-func NewBackendClient(cacheSize, workerCount int) (*BackendClient, error) {
-	httpClient := &fasthttp.Client{}
-	requestPool := sync.Pool{
+// NewBackendClient initializes a new BackendClient for the given backends from the application and upstream configuration.
+func NewBackendClient(backends config.BackendConfig, appConfig *models.Config) (*BackendClient, error) {
+	httpClient := &fasthttp.Client{
+		ReadTimeout:  appConfig.Upstream.ReadTimeout,
+		WriteTimeout: appConfig.Upstream.WriteTimeout,
+	}
+	requestPool := &sync.Pool{
 		New: func() interface{} {
 			return new(fasthttp.Request)
 		},
 	}
 
-	cache, err := lru.New(cacheSize)
+	cache, err := newCompanyCache(appConfig.Application.CacheSize)
 	if err != nil {
 		return nil, err
 	}
 
+	cacheMode := appConfig.Upstream.CacheMode
+	switch cacheMode {
+	case "":
+		cacheMode = models.CacheModeStandard
+	case models.CacheModeStandard, models.CacheModeStaleWhileRevalidate:
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnknownMode, cacheMode)
+	}
+
+	decoders, err := newRegistry(appConfig.Upstream.Mappings)
+	if err != nil {
+		return nil, err
+	}
+
+	upstream := appConfig.Upstream
+	upstream.HealthCheck = upstream.HealthCheck.WithDefaults()
+
+	replicas := make(map[string]*replicaSet, len(backends))
+	breakers := make(map[string]*circuitBreaker, len(backends))
+	for country := range backends {
+		settings := appConfig.Upstream.For(country)
+		if replicas[country], err = newReplicaSet(backends.Replicas(country), settings.LoadBalancing); err != nil {
+			return nil, fmt.Errorf("backend of %q: %w", country, err)
+		}
+		breakers[country] = newCircuitBreaker(settings.Breaker)
+	}
+
+	queueDepth := appConfig.Application.QueueDepth
+	if queueDepth <= 0 {
+		queueDepth = DefaultQueueDepth
+	}
+	// Each queue can hold the whole depth, so that enqueueing never blocks
+	var queues [priorityLevels]chan requestInfo
+	for i := range queues {
+		// Room for as many abandoned requests as live ones, which stay in the
+		// channel until a worker skips them
+		queues[i] = make(chan requestInfo, 2*queueDepth)
+	}
+
+	autoscale := appConfig.Application.Autoscale
+	if autoscale.Enabled {
+		autoscale = autoscale.WithDefaults(appConfig.Application.Workers)
+	}
+
 	return &BackendClient{
-		httpClient:  httpClient,
-		requestPool: requestPool,
-		cache:       cache,
-		requests:    make(chan requestInfo),
-		workers:     workerCount,
+		httpClient:      httpClient,
+		requestPool:     requestPool,
+		cache:           cache,
+		inflight:        make(map[string]*sharedCall),
+		cacheMode:       cacheMode,
+		replicas:        replicas,
+		breakers:        breakers,
+		decoders:        decoders,
+		upstreamMetrics: newUpstreamMetrics(),
+		hedging:         appConfig.Upstream.Hedging.WithDefaults(),
+		upstream:        upstream,
+		stop:            make(chan struct{}),
+		queues:          queues,
+		queueDepth:      int64(queueDepth),
+		queueWait:       appConfig.Application.MaxQueueWait,
+		workers:         appConfig.Application.Workers,
+		autoscale:       autoscale,
+		retire:          make(chan struct{}),
 	}, nil
 }
 
-// StartWorkers starts the worker goroutines to process requests.
+// StartWorkers starts the worker goroutines to process requests, and the
+// autoscaler and health checker if enabled.
 func (bc *BackendClient) StartWorkers() {
-	for i := 0; i < bc.workers; i++ {
+	workers := bc.workers
+	if bc.autoscale.Enabled {
+		workers = bc.autoscale.MinWorkers
+	}
+	for i := 0; i < workers; i++ {
+		bc.startWorker()
+	}
+	bc.pool.running.Store(true)
+
+	if bc.autoscale.Enabled {
 		bc.wg.Add(1)
-		go bc.worker()
-		bc.availableWorkers++
+		go bc.runAutoscaler(bc.stop)
+	}
+
+	if bc.upstream.HealthCheck.Enabled {
+		bc.wg.Add(1)
+		go bc.runHealthChecks(bc.stop)
 	}
 }
 
-// StopWorkers stops the worker goroutines.
+// StopWorkers stops the worker goroutines and the health checker, and fails
+// the requests still queued.
 func (bc *BackendClient) StopWorkers() {
-	close(bc.requests)
+	bc.pool.running.Store(false)
+	close(bc.stop)
 	bc.wg.Wait()
+	bc.drain()
 }
 
+// WorkersAvailable reports whether the pool is running and can take a request,
+// either on an idle worker or in its queue.
 func (bc *BackendClient) WorkersAvailable() bool {
-	return bc.availableWorkers > 0
+	if !bc.pool.running.Load() {
+		return false
+	}
+	return bc.pool.busy.Load() < bc.pool.size.Load() || bc.pool.queued.Load() < bc.queueDepth
+}
+
+// FetchCompanyData fetches company data, sharing a single worker pool request
+// between concurrent lookups of the same company at the same priority.
+// The lookup is abandoned with ErrTimeout once ctx is done.
+func (bc *BackendClient) FetchCompanyData(ctx context.Context, country, id string) (*models.Company, error) {
+	bc.coalescing.lookups.Add(1)
+
+	// Lookups of different priorities are not shared, so that a batch lookup
+	// never holds an interactive one back in the low priority queue
+	priority := priorityFrom(ctx)
+	key := country + "/" + id + "/" + strconv.Itoa(int(priority))
+	for {
+		call, joined := bc.join(ctx, key, priority, country, id)
+		select {
+		case <-call.done:
+			if joined && errors.Is(call.err, ErrTimeout) && outlives(ctx, call) {
+				// The lookup ran out of the time of the caller that started it,
+				// this caller has time left for a lookup of its own
+				continue
+			}
+			if joined {
+				bc.coalescing.collapsed.Add(1)
+			}
+			if info := lookupInfoFrom(ctx); info != nil {
+				*info = call.info
+				info.Coalesced = joined
+			}
+			return call.company, call.err
+		case <-ctx.Done():
+			bc.leave(key, call)
+			return nil, fmt.Errorf("%w: %v", ErrTimeout, ctx.Err())
+		}
+	}
 }
 
-// FetchCompanyData sends a request to the worker pool to fetch company data.
-func (bc *BackendClient) FetchCompanyData(backendURL, id string) (*models.Company, error) {
-	resultChan := make(chan *models.Company)
-	req := requestInfo{
-		backendURL: backendURL,
-		id:         id,
-		result:     resultChan,
+// join returns the lookup in flight for key, starting one for ctx if there is none.
+func (bc *BackendClient) join(ctx context.Context, key string, priority Priority, country, id string) (*sharedCall, bool) {
+	bc.inflightMu.Lock()
+	defer bc.inflightMu.Unlock()
+
+	call, joined := bc.inflight[key]
+	if !joined {
+		bc.coalescing.upstream.Add(1)
+
+		// The request is shared, so it must not be cancelled when its first caller gives up
+		sharedCtx, cancel := detach(ctx)
+		call = &sharedCall{done: make(chan struct{}), cancel: cancel}
+		call.deadline, call.hasDeadline = ctx.Deadline()
+		bc.inflight[key] = call
+		go bc.share(sharedCtx, key, call, priority, country, id)
 	}
+	call.waiters++
+	return call, joined
+}
 
-	select {
-	case bc.requests <- req:
-		result := <-resultChan
-		close(req.result)
-		return result, nil
-	default:
-		// Handle case where sending the request to the worker pool fails (e.g., worker pool is full)
-		close(req.result)
-		return nil, errors.New("failed to send request to worker pool")
+// outlives reports whether ctx is still live and has a later deadline than
+// the shared lookup.
+func outlives(ctx context.Context, call *sharedCall) bool {
+	if ctx.Err() != nil || !call.hasDeadline {
+		return false
 	}
+	deadline, ok := ctx.Deadline()
+	return !ok || deadline.After(call.deadline)
 }
 
-func (bc *BackendClient) worker() {
-	defer bc.wg.Done()
-	for {
-		req, more := <-bc.requests
-		bc.availableWorkers--
-		if !more {
-			// The requests channel is closed, so the worker can exit.
-			return
+// share runs a shared lookup and hands its outcome to the callers waiting for it.
+func (bc *BackendClient) share(ctx context.Context, key string, call *sharedCall, priority Priority, country, id string) {
+	call.company, call.info, call.err = bc.enqueue(ctx, priority, country, id)
+
+	bc.inflightMu.Lock()
+	if bc.inflight[key] == call {
+		delete(bc.inflight, key)
+	}
+	bc.inflightMu.Unlock()
+	call.cancel()
+	close(call.done)
+}
+
+// leave stops waiting for a shared lookup, cancelling it when it was the last caller.
+func (bc *BackendClient) leave(key string, call *sharedCall) {
+	bc.inflightMu.Lock()
+	defer bc.inflightMu.Unlock()
+	call.waiters--
+	if call.waiters > 0 {
+		return
+	}
+	// Later callers start a lookup of their own rather than join a cancelled one
+	if bc.inflight[key] == call {
+		delete(bc.inflight, key)
+	}
+	call.cancel()
+}
+
+// lookup answers a request from the cache, falling back to the country backend.
+func (bc *BackendClient) lookup(req requestInfo) (*models.Company, error) {
+	key := cacheKey{country: req.country, id: req.id}
+	entry, cached := bc.cache.get(key, time.Now())
+	hit := cached && entry.fresh(time.Now())
+	bc.cache.record(hit)
+	if hit {
+		if info := lookupInfoFrom(req.ctx); info != nil {
+			info.CacheHit = true
 		}
-		cachedResponse, found := bc.cache.Get(req.id)
-		var company *models.Company
-
-		// Extract backendURL from the request
-		backendURL := req.backendURL
-		id := req.id
-		if found {
-			if cachedCompany, ok := cachedResponse.(*models.Company); ok {
-				company = cachedCompany
-			}
-		} else {
-			request := bc.requestPool.Get().(*fasthttp.Request)
-			request.SetRequestURI(backendURL + "/companies/" + id)
+		if entry.company == nil {
+			return nil, ErrNotFound
+		}
+		if entry.needsRefresh(time.Now()) {
+			bc.revalidate(key)
+		}
+		return withCurrentStatus(entry.company), nil
+	}
 
-			var resp fasthttp.Response
-			if err := bc.httpClient.Do(request, &resp); err != nil {
-				request.Header.Reset()
-				bc.requestPool.Put(request)
+	company, err := bc.fetchAndCache(req.ctx, key)
+	if err != nil && !errors.Is(err, ErrNotFound) && cached && entry.company != nil {
+		// Only entries kept past their TTL by stale-while-revalidate get here
+		stale := withCurrentStatus(entry.company)
+		stale.Stale = true
+		return stale, nil
+	}
+	return company, err
+}
 
-				req.result <- nil
-				bc.availableWorkers--
-				continue
-			}
+// fetchAndCache fetches a company from its country backend and caches the answer.
+func (bc *BackendClient) fetchAndCache(ctx context.Context, key cacheKey) (*models.Company, error) {
+	set, ok := bc.replicas[key.country]
+	if !ok {
+		return nil, ErrUnknownBackend
+	}
+
+	// Fail fast while the backend is known to be down
+	breaker := bc.breakers[key.country]
+	if !breaker.allow(time.Now()) {
+		return nil, ErrCircuitOpen
+	}
 
-			parsedCompany, err := ParseCompanyResponse(&resp, id)
-			if err != nil {
-				request.Header.Reset()
-				bc.requestPool.Put(request)
+	start := time.Now()
+	company, err := bc.fetchWithFailover(ctx, set, bc.upstream.For(key.country), key.id)
+	elapsed := time.Since(start)
+	bc.upstreamMetrics.observe(key.country, elapsed, err)
+	if info := lookupInfoFrom(ctx); info != nil {
+		info.Upstream = elapsed
+	}
+	if company != nil {
+		company.Country = key.country
+		company.FetchedAt = time.Now()
+	}
+	if callerFault(ctx, err, start, bc.upstream.For(key.country).RequestTimeout) {
+		breaker.forgo()
+	} else {
+		breaker.record(err == nil || errors.Is(err, ErrNotFound), time.Now())
+	}
+	if err == nil || errors.Is(err, ErrNotFound) {
+		bc.cache.add(key, newCacheEntry(company, bc.cacheMode, bc.upstream.For(key.country), time.Now()))
+	}
+	return company, err
+}
 
-				req.result <- nil
-				bc.availableWorkers--
-				continue
-			}
-			company = parsedCompany
-			bc.cache.Add(id, company)
-			request.Header.Reset()
-			bc.requestPool.Put(request)
+// revalidate refreshes a cached company in the background, at most once at a time per key.
+func (bc *BackendClient) revalidate(key cacheKey) {
+	if _, running := bc.refreshing.LoadOrStore(key, struct{}{}); running {
+		return
+	}
+
+	go func() {
+		defer bc.refreshing.Delete(key)
+		ctx, cancel := context.WithTimeout(context.Background(), bc.upstream.For(key.country).RequestTimeout)
+		defer cancel()
+		// On failure the current entry is kept and served until it expires
+		bc.fetchAndCache(ctx, key)
+	}()
+}
+
+// fetchOnce requests a company from a backend and parses the response.
+func (bc *BackendClient) fetchOnce(ctx context.Context, backendURL, id string) (company *models.Company, err error) {
+	ctx, span := tracing.StartKind(ctx, "upstream", tracing.SpanKindClient)
+	span.SetAttribute("backend", backendURL)
+	defer func() {
+		if !errors.Is(err, ErrNotFound) {
+			span.SetError(err)
 		}
+		span.End()
+	}()
+
+	request := bc.requestPool.Get().(*fasthttp.Request)
+	defer func() {
+		request.Header.Reset()
+		bc.requestPool.Put(request)
+	}()
+	request.SetRequestURI(backendURL + "/companies/" + id)
+	if sc := span.Context(); sc.Valid() {
+		// Let the backend continue the trace
+		request.Header.Set(tracing.TraceparentHeader, sc.Traceparent())
+	}
+	if id := requestIDFrom(ctx); id != "" {
+		request.Header.Set(RequestIDHeader, id)
+	}
 
-		req.result <- company
-		bc.availableWorkers--
+	var resp fasthttp.Response
+	if err := bc.do(ctx, request, &resp); err != nil {
+		return nil, err
+	}
+
+	status := resp.StatusCode()
+	span.SetAttribute("status", strconv.Itoa(status))
+	switch {
+	case status == fasthttp.StatusNotFound:
+		return nil, ErrNotFound
+	case status < 200 || status > 299:
+		return nil, &StatusError{StatusCode: status}
+	}
+
+	_, parseSpan := tracing.Start(ctx, "parse")
+	defer parseSpan.End()
+	company, err = bc.decoders.Decode(string(resp.Header.ContentType()), resp.Body(), id)
+	parseSpan.SetError(err)
+	return company, err
+}
+
+// StatusError is returned when a backend answers with an unexpected status code.
+type StatusError struct {
+	StatusCode int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("%v: status %d", ErrInvalidResponse, e.StatusCode)
+}
+
+func (e *StatusError) Unwrap() error {
+	return ErrInvalidResponse
+}
+
+// do performs the backend call, bounded by the deadline of ctx if it has one.
+func (bc *BackendClient) do(ctx context.Context, request *fasthttp.Request, resp *fasthttp.Response) error {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return bc.httpClient.Do(request, resp)
+	}
 
+	err := bc.httpClient.DoDeadline(request, resp, deadline)
+	if errors.Is(err, fasthttp.ErrTimeout) {
+		return fmt.Errorf("%w: %v", ErrTimeout, err)
 	}
+	return err
+}
+
+// detach returns a context with the deadline of ctx that is not cancelled along with it.
+func detach(ctx context.Context) (context.Context, context.CancelFunc) {
+	// Keep the trace and the request id of the caller, the only values the lookup needs
+	detached := tracing.ContextWithSpan(context.Background(), tracing.SpanFromContext(ctx))
+	if id := requestIDFrom(ctx); id != "" {
+		detached = WithRequestID(detached, id)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		return context.WithDeadline(detached, deadline)
+	}
+	return context.WithCancel(detached)
 }
 
 func isClosedDateInThePast(dateStr string) bool {
@@ -173,44 +532,7 @@ func isClosedDateInThePast(dateStr string) bool {
 	return closedDate.Before(time.Now())
 }
 
-// ParseCompanyResponse parses the response based on content type and returns a Company.
+// ParseCompanyResponse parses the response with the default decoder registered for its content type.
 func ParseCompanyResponse(resp *fasthttp.Response, id string) (*models.Company, error) {
-	var company models.Company
-
-	contentType := string(resp.Header.ContentType())
-
-	switch {
-	case strings.HasPrefix(contentType, "application/x-company-v1"):
-		var v1Response struct {
-			CN        string `json:"cn"`
-			CreatedOn string `json:"created_on"`
-			ClosedOn  string `json:"closed_on,omitempty"`
-		}
-		if err := json.Unmarshal(resp.Body(), &v1Response); err != nil {
-			return nil, err
-		}
-		company.ID = id
-		company.Name = v1Response.CN
-		company.Active = v1Response.ClosedOn == "" || !isClosedDateInThePast(v1Response.ClosedOn)
-		company.ActiveUntil = v1Response.ClosedOn
-
-	case strings.HasPrefix(contentType, "application/x-company-v2"):
-		var v2Response struct {
-			CompanyName string `json:"company_name"`
-			TIN         string `json:"tin"`
-			DissolvedOn string `json:"dissolved_on,omitempty"`
-		}
-		if err := json.Unmarshal(resp.Body(), &v2Response); err != nil {
-			return nil, err
-		}
-		company.ID = id
-		company.Name = v2Response.CompanyName
-		company.Active = v2Response.DissolvedOn == "" || !isClosedDateInThePast(v2Response.DissolvedOn)
-		company.ActiveUntil = v2Response.DissolvedOn
-
-	default:
-		return nil, errors.New("unsupported content type")
-	}
-
-	return &company, nil
+	return DefaultDecoders.Decode(string(resp.Header.ContentType()), resp.Body(), id)
 }
@@ -1,7 +1,15 @@
 package client
 
 import (
+	"backendify/pkg/models"
+	"backendify/pkg/tracing"
+	"context"
 	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -176,3 +184,291 @@ func TestParseCompanyResponse(t *testing.T) {
 		assert.Equal(t, v2Response.DissolvedOn, company.ActiveUntil, "Expected ActiveUntil to be set")
 	})
 }
+
+func TestFetchCompanyDataDeadline(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+		w.Header().Set("Content-Type", "application/x-company-v1")
+		w.Write([]byte(`{"cn":"Company Name","created_on":"2023-01-01T00:00:00Z"}`))
+	}))
+	defer backend.Close()
+
+	config := &models.Config{
+		Application: models.ApplicationConfig{
+			CacheSize: 10,
+			Workers:   1,
+		},
+	}
+	bc, err := NewBackendClient(map[string]string{"us": backend.URL}, config)
+	assert.NoError(t, err)
+	bc.StartWorkers()
+	defer bc.StopWorkers()
+
+	t.Run("Deadline exceeded", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+
+		start := time.Now()
+		company, err := bc.FetchCompanyData(ctx, "us", "1")
+		assert.ErrorIs(t, err, ErrTimeout, "Expected a timeout error")
+		assert.Nil(t, company, "Expected no company data")
+		assert.Less(t, time.Since(start), 150*time.Millisecond, "Expected the call to return at the deadline")
+	})
+
+	t.Run("Within deadline", func(t *testing.T) {
+		// Let the worker drain the abandoned request first
+		time.Sleep(250 * time.Millisecond)
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		company, err := bc.FetchCompanyData(ctx, "us", "2")
+		assert.NoError(t, err, "Expected no error")
+		assert.Equal(t, "Company Name", company.Name, "Expected company data")
+	})
+}
+
+func TestFetchCompanyDataCoalescing(t *testing.T) {
+	var calls int32
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		time.Sleep(100 * time.Millisecond)
+		w.Header().Set("Content-Type", "application/x-company-v1")
+		w.Write([]byte(`{"cn":"Company Name","created_on":"2023-01-01T00:00:00Z"}`))
+	}))
+	defer backend.Close()
+
+	config := &models.Config{
+		Application: models.ApplicationConfig{
+			CacheSize: 10,
+			Workers:   1,
+		},
+	}
+	bc, err := NewBackendClient(map[string]string{"us": backend.URL}, config)
+	assert.NoError(t, err)
+	bc.StartWorkers()
+	defer bc.StopWorkers()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			company, err := bc.FetchCompanyData(context.Background(), "us", "1")
+			assert.NoError(t, err, "Expected no error")
+			assert.Equal(t, "Company Name", company.Name, "Expected company data")
+		}()
+	}
+	wg.Wait()
+
+	stats := bc.Stats().Coalescing
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls), "Expected a single backend call")
+	assert.Equal(t, int64(10), stats.Lookups)
+	assert.Equal(t, int64(1), stats.Upstream)
+	assert.Equal(t, int64(9), stats.Collapsed)
+}
+
+func TestFetchCompanyDataCoalescingJoiners(t *testing.T) {
+	var calls int32
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		time.Sleep(150 * time.Millisecond)
+		w.Header().Set("Content-Type", "application/x-company-v1")
+		w.Write([]byte(`{"cn":"Company Name","created_on":"2023-01-01T00:00:00Z"}`))
+	}))
+	defer backend.Close()
+
+	config := &models.Config{
+		Application: models.ApplicationConfig{
+			CacheSize: 10,
+			Workers:   2,
+		},
+	}
+	bc, err := NewBackendClient(map[string]string{"us": backend.URL}, config)
+	assert.NoError(t, err)
+	bc.StartWorkers()
+	defer bc.StopWorkers()
+
+	t.Run("Different priorities are not shared", func(t *testing.T) {
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := bc.FetchCompanyData(WithPriority(context.Background(), PriorityLow), "us", "1")
+			assert.NoError(t, err)
+		}()
+		time.Sleep(20 * time.Millisecond)
+
+		_, err := bc.FetchCompanyData(context.Background(), "us", "1")
+		assert.NoError(t, err)
+		wg.Wait()
+
+		assert.Equal(t, int32(2), atomic.LoadInt32(&calls), "Expected a backend call per priority")
+		assert.Equal(t, int64(0), bc.Stats().Coalescing.Collapsed)
+	})
+
+	t.Run("Joiner outlives the first caller", func(t *testing.T) {
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			defer cancel()
+			_, err := bc.FetchCompanyData(ctx, "us", "2")
+			assert.ErrorIs(t, err, ErrTimeout)
+		}()
+		time.Sleep(20 * time.Millisecond)
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		company, err := bc.FetchCompanyData(ctx, "us", "2")
+		assert.NoError(t, err, "Expected the joiner to get the company within its own deadline")
+		if assert.NotNil(t, company) {
+			assert.Equal(t, "Company Name", company.Name)
+		}
+		wg.Wait()
+	})
+}
+
+func TestFetchCompanyDataTraceparent(t *testing.T) {
+	var received atomic.Value
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received.Store(r.Header.Get(tracing.TraceparentHeader))
+		w.Header().Set("Content-Type", "application/x-company-v1")
+		w.Write([]byte(`{"cn":"Company Name","created_on":"2023-01-01T00:00:00Z"}`))
+	}))
+	defer backend.Close()
+
+	tracingConfig := models.TracingConfig{Enabled: true, Exporter: tracing.ExporterFile, FilePath: filepath.Join(t.TempDir(), "spans.jsonl")}
+	tracer, err := tracing.NewTracer(tracingConfig, nil)
+	assert.NoError(t, err)
+	tracing.SetTracer(tracer)
+	defer tracer.Shutdown()
+	defer tracing.SetTracer(nil)
+
+	config := &models.Config{
+		Application: models.ApplicationConfig{
+			CacheSize: 10,
+			Workers:   1,
+		},
+	}
+	bc, err := NewBackendClient(map[string]string{"us": backend.URL}, config)
+	assert.NoError(t, err)
+	bc.StartWorkers()
+	defer bc.StopWorkers()
+
+	ctx, root := tracing.Start(context.Background(), "request")
+	defer root.End()
+	_, err = bc.FetchCompanyData(ctx, "us", "1")
+	assert.NoError(t, err, "Expected no error")
+
+	header, _ := received.Load().(string)
+	sc, ok := tracing.ParseTraceparent(header)
+	assert.True(t, ok, "Expected the backend to receive a traceparent header")
+	assert.Equal(t, root.Context().TraceID, sc.TraceID, "Expected the backend to continue the trace of the request")
+	assert.NotEqual(t, root.Context().SpanID, sc.SpanID, "Expected the upstream span as parent")
+}
+
+func TestFetchCompanyDataLookupInfo(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/x-company-v1")
+		w.Write([]byte(`{"cn":"Company Name","created_on":"2023-01-01T00:00:00Z"}`))
+	}))
+	defer backend.Close()
+
+	config := &models.Config{
+		Application: models.ApplicationConfig{
+			CacheSize: 10,
+			Workers:   1,
+		},
+		Upstream: models.UpstreamConfig{CacheTTL: time.Minute},
+	}
+	bc, err := NewBackendClient(map[string]string{"us": backend.URL}, config)
+	assert.NoError(t, err)
+	bc.StartWorkers()
+	defer bc.StopWorkers()
+
+	var miss, hit LookupInfo
+	_, err = bc.FetchCompanyData(WithLookupInfo(context.Background(), &miss), "us", "1")
+	assert.NoError(t, err, "Expected no error")
+	assert.False(t, miss.CacheHit, "Expected the first lookup to miss the cache")
+	assert.Greater(t, miss.Upstream, time.Duration(0), "Expected the upstream latency of the first lookup")
+
+	_, err = bc.FetchCompanyData(WithLookupInfo(context.Background(), &hit), "us", "1")
+	assert.NoError(t, err, "Expected no error")
+	assert.True(t, hit.CacheHit, "Expected the second lookup to hit the cache")
+	assert.Zero(t, hit.Upstream, "Expected no upstream call on a cache hit")
+}
+
+func TestFetchCompanyDataRequestID(t *testing.T) {
+	var received atomic.Value
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received.Store(r.Header.Get(RequestIDHeader))
+		w.Header().Set("Content-Type", "application/x-company-v1")
+		w.Write([]byte(`{"cn":"Company Name","created_on":"2023-01-01T00:00:00Z"}`))
+	}))
+	defer backend.Close()
+
+	config := &models.Config{
+		Application: models.ApplicationConfig{
+			CacheSize: 10,
+			Workers:   1,
+		},
+	}
+	bc, err := NewBackendClient(map[string]string{"us": backend.URL}, config)
+	assert.NoError(t, err)
+	bc.StartWorkers()
+	defer bc.StopWorkers()
+
+	_, err = bc.FetchCompanyData(WithRequestID(context.Background(), "abc-123"), "us", "1")
+	assert.NoError(t, err, "Expected no error")
+	assert.Equal(t, "abc-123", received.Load(), "Expected the request id to be forwarded to the backend")
+}
+
+func TestFetchCompanyDataAbandoned(t *testing.T) {
+	var calls int32
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		time.Sleep(200 * time.Millisecond)
+		w.Header().Set("Content-Type", "application/x-company-v1")
+		w.Write([]byte(`{"cn":"Company Name","created_on":"2023-01-01T00:00:00Z"}`))
+	}))
+	defer backend.Close()
+
+	config := &models.Config{
+		Application: models.ApplicationConfig{
+			CacheSize: 10,
+			Workers:   1,
+		},
+	}
+	bc, err := NewBackendClient(map[string]string{"us": backend.URL}, config)
+	assert.NoError(t, err)
+	bc.StartWorkers()
+	defer bc.StopWorkers()
+
+	// Keep the only worker busy
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		bc.FetchCompanyData(context.Background(), "us", "1")
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	// Both callers of the queued lookup give up, so nobody needs it anymore
+	ctx, cancel := context.WithCancel(context.Background())
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := bc.FetchCompanyData(ctx, "us", "2")
+			assert.ErrorIs(t, err, ErrTimeout)
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	wg.Wait()
+
+	time.Sleep(300 * time.Millisecond)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls), "Expected the abandoned lookup not to reach the backend")
+}
@@ -0,0 +1,191 @@
+package client
+
+import (
+	"backendify/pkg/config"
+	"backendify/pkg/models"
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	ErrUnknownStrategy = errors.New("unknown load-balancing strategy")
+	ErrNoReplicas      = errors.New("no backend replica configured")
+)
+
+// replica is one upstream URL of a country backend.
+type replica struct {
+	url         string
+	weight      int
+	outstanding atomic.Int64
+	health      replicaHealth
+
+	mu           sync.Mutex
+	failures     int
+	ejectedUntil time.Time
+	current      int // smooth weighted round-robin state
+}
+
+// available reports whether the replica is in rotation: neither ejected
+// after failed calls nor failing its health checks.
+func (r *replica) available(now time.Time) bool {
+	return !r.ejected(now) && r.health.isHealthy()
+}
+
+func (r *replica) ejected(now time.Time) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return now.Before(r.ejectedUntil)
+}
+
+// record updates the replica with the outcome of a call, ejecting it after
+// too many consecutive failures.
+func (r *replica) record(success bool, config models.LoadBalancingConfig, now time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if success {
+		r.failures = 0
+		return
+	}
+	r.failures++
+	if r.failures >= config.EjectAfter {
+		r.ejectedUntil = now.Add(config.EjectFor)
+		r.failures = 0
+	}
+}
+
+// replicaSet balances the requests of a country over its replicas.
+type replicaSet struct {
+	replicas []*replica
+	config   models.LoadBalancingConfig
+	next     atomic.Uint64
+	mu       sync.Mutex // guards the weighted round-robin state
+}
+
+func newReplicaSet(replicas []config.Replica, lbConfig models.LoadBalancingConfig) (*replicaSet, error) {
+	switch lbConfig.Strategy {
+	case models.BalancerRoundRobin, models.BalancerLeastOutstanding, models.BalancerWeighted:
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnknownStrategy, lbConfig.Strategy)
+	}
+	if len(replicas) == 0 {
+		return nil, ErrNoReplicas
+	}
+
+	set := &replicaSet{config: lbConfig}
+	for _, r := range replicas {
+		set.replicas = append(set.replicas, &replica{url: r.URL, weight: r.Weight, health: replicaHealth{healthy: true}})
+	}
+	return set, nil
+}
+
+// pick chooses the replica for the next call, skipping the ones already tried.
+// Replicas out of rotation are only used once every other replica has been tried.
+func (s *replicaSet) pick(tried map[*replica]bool, now time.Time) *replica {
+	var candidates, unavailable []*replica
+	for _, r := range s.replicas {
+		switch {
+		case tried[r]:
+		case r.available(now):
+			candidates = append(candidates, r)
+		default:
+			unavailable = append(unavailable, r)
+		}
+	}
+	if len(candidates) == 0 {
+		candidates = unavailable
+	}
+	if len(candidates) == 0 {
+		return nil
+	}
+
+	switch s.config.Strategy {
+	case models.BalancerLeastOutstanding:
+		offset := int(s.next.Add(1))
+		best := candidates[offset%len(candidates)]
+		for i := range candidates {
+			r := candidates[(offset+i)%len(candidates)]
+			if r.outstanding.Load() < best.outstanding.Load() {
+				best = r
+			}
+		}
+		return best
+	case models.BalancerWeighted:
+		return s.pickWeighted(candidates)
+	default:
+		return candidates[int(s.next.Add(1)-1)%len(candidates)]
+	}
+}
+
+// pickWeighted implements smooth weighted round-robin over the candidates.
+func (s *replicaSet) pickWeighted(candidates []*replica) *replica {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	total := 0
+	var best *replica
+	for _, r := range candidates {
+		r.current += r.weight
+		total += r.weight
+		if best == nil || r.current > best.current {
+			best = r
+		}
+	}
+	best.current -= total
+	return best
+}
+
+// fetchWithFailover fetches a company from one of the replicas of a country,
+// failing over to the next replica when one errors.
+func (bc *BackendClient) fetchWithFailover(ctx context.Context, set *replicaSet, settings models.CountryUpstreamConfig, id string) (*models.Company, error) {
+	tried := make(map[*replica]bool, len(set.replicas))
+	var err error
+	for {
+		// Replica sets are never empty, so there is an error once all are tried
+		r := set.pick(tried, time.Now())
+		if r == nil {
+			return nil, err
+		}
+		tried[r] = true
+
+		var company *models.Company
+		start := time.Now()
+		r.outstanding.Add(1)
+		company, err = bc.fetchWithRetry(ctx, settings.Retry, r.url, id)
+		r.outstanding.Add(-1)
+
+		definitive := err == nil || errors.Is(err, ErrNotFound)
+		if !callerFault(ctx, err, start, settings.RequestTimeout) {
+			r.record(definitive, set.config, time.Now())
+		}
+		if definitive || errors.Is(err, ErrTimeout) {
+			// Another replica would not answer any differently, or in time
+			return company, err
+		}
+	}
+}
+
+// ReplicaStats is a snapshot of a replica of a country backend.
+type ReplicaStats struct {
+	URL         string `json:"url"`
+	Weight      int    `json:"weight"`
+	Outstanding int64  `json:"outstanding"`
+	Ejected     bool   `json:"ejected"`
+}
+
+func (s *replicaSet) stats(now time.Time) []ReplicaStats {
+	stats := make([]ReplicaStats, 0, len(s.replicas))
+	for _, r := range s.replicas {
+		stats = append(stats, ReplicaStats{
+			URL:         r.url,
+			Weight:      r.weight,
+			Outstanding: r.outstanding.Load(),
+			Ejected:     r.ejected(now),
+		})
+	}
+	return stats
+}
@@ -0,0 +1,97 @@
+package client
+
+import (
+	"backendify/pkg/config"
+	"backendify/pkg/models"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReplicaSetPick(t *testing.T) {
+	replicas := []config.Replica{
+		{URL: "http://a", Weight: 3},
+		{URL: "http://b", Weight: 1},
+	}
+	now := time.Now()
+
+	countPicks := func(set *replicaSet, n int) map[string]int {
+		picks := make(map[string]int)
+		for i := 0; i < n; i++ {
+			picks[set.pick(nil, now).url]++
+		}
+		return picks
+	}
+
+	t.Run("Round-robin", func(t *testing.T) {
+		set, err := newReplicaSet(replicas, models.LoadBalancingConfig{Strategy: models.BalancerRoundRobin})
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]int{"http://a": 4, "http://b": 4}, countPicks(set, 8))
+	})
+
+	t.Run("Weighted", func(t *testing.T) {
+		set, err := newReplicaSet(replicas, models.LoadBalancingConfig{Strategy: models.BalancerWeighted})
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]int{"http://a": 6, "http://b": 2}, countPicks(set, 8))
+	})
+
+	t.Run("Least outstanding", func(t *testing.T) {
+		set, err := newReplicaSet(replicas, models.LoadBalancingConfig{Strategy: models.BalancerLeastOutstanding})
+		assert.NoError(t, err)
+		set.replicas[0].outstanding.Add(5)
+		assert.Equal(t, map[string]int{"http://b": 4}, countPicks(set, 4))
+	})
+
+	t.Run("Ejected replicas are skipped", func(t *testing.T) {
+		lbConfig := models.LoadBalancingConfig{Strategy: models.BalancerRoundRobin, EjectAfter: 2, EjectFor: time.Minute}
+		set, err := newReplicaSet(replicas, lbConfig)
+		assert.NoError(t, err)
+
+		set.replicas[1].record(false, lbConfig, now)
+		set.replicas[1].record(false, lbConfig, now)
+		assert.Equal(t, map[string]int{"http://a": 4}, countPicks(set, 4))
+
+		tried := map[*replica]bool{set.replicas[0]: true}
+		assert.Equal(t, "http://b", set.pick(tried, now).url, "Expected ejected replicas as a last resort")
+	})
+
+	t.Run("Unknown strategy", func(t *testing.T) {
+		_, err := newReplicaSet(replicas, models.LoadBalancingConfig{Strategy: "random"})
+		assert.ErrorIs(t, err, ErrUnknownStrategy)
+	})
+
+	t.Run("No replicas", func(t *testing.T) {
+		_, err := newReplicaSet(nil, models.LoadBalancingConfig{Strategy: models.BalancerRoundRobin})
+		assert.ErrorIs(t, err, ErrNoReplicas)
+
+		_, err = NewBackendClient(map[string]string{"us": " , "}, &models.Config{Application: models.ApplicationConfig{CacheSize: 10}})
+		assert.ErrorIs(t, err, ErrNoReplicas, "Expected a country without replicas to be rejected")
+	})
+}
+
+func TestFetchWithFailover(t *testing.T) {
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer down.Close()
+	up := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/x-company-v1")
+		w.Write([]byte(`{"cn":"Company Name","created_on":"2023-01-01T00:00:00Z"}`))
+	}))
+	defer up.Close()
+
+	backends := config.BackendConfig{"us": down.URL + "," + up.URL}
+	bc, err := NewBackendClient(backends, &models.Config{Application: models.ApplicationConfig{CacheSize: 10}})
+	assert.NoError(t, err)
+
+	for i := 0; i < 4; i++ {
+		company, err := bc.fetchAndCache(context.Background(), cacheKey{country: "us", id: "1"})
+		assert.NoError(t, err, "Expected the healthy replica to answer")
+		assert.Equal(t, "Company Name", company.Name)
+	}
+	assert.Equal(t, BreakerClosed, bc.Stats().Breakers["us"].State)
+}
@@ -0,0 +1,116 @@
+package client
+
+import (
+	"backendify/pkg/models"
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// Circuit breaker states.
+const (
+	BreakerClosed   = "closed"
+	BreakerOpen     = "open"
+	BreakerHalfOpen = "half-open"
+)
+
+// circuitBreaker stops calls to a backend after too many consecutive failures.
+// Once the cool-down has passed, a limited number of trial calls decide
+// whether the breaker closes again or reopens.
+type circuitBreaker struct {
+	mu       sync.Mutex
+	config   models.BreakerConfig
+	state    string
+	failures int
+	openedAt time.Time
+	trials   int
+}
+
+func newCircuitBreaker(config models.BreakerConfig) *circuitBreaker {
+	return &circuitBreaker{config: config, state: BreakerClosed}
+}
+
+// allow reports whether a call may go to the backend.
+func (b *circuitBreaker) allow(now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == BreakerOpen && now.Sub(b.openedAt) >= b.config.CoolDown {
+		b.state = BreakerHalfOpen
+		b.trials = 0
+	}
+
+	switch b.state {
+	case BreakerOpen:
+		return false
+	case BreakerHalfOpen:
+		if b.trials >= b.config.HalfOpenRequests {
+			return false
+		}
+		b.trials++
+	}
+	return true
+}
+
+// record updates the breaker with the outcome of a call it allowed.
+func (b *circuitBreaker) record(success bool, now time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if success {
+		b.state = BreakerClosed
+		b.failures = 0
+		return
+	}
+
+	b.failures++
+	if b.state == BreakerHalfOpen || b.failures >= b.config.FailureThreshold {
+		b.state = BreakerOpen
+		b.openedAt = now
+	}
+}
+
+// forgo gives back the trial of a call whose outcome says nothing about the backend.
+func (b *circuitBreaker) forgo() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == BreakerHalfOpen && b.trials > 0 {
+		b.trials--
+	}
+}
+
+// callerFault reports whether a call started at start failed because of its
+// caller rather than its backend: the caller gave up on it, or left it less
+// than half of the request timeout, having spent the rest queueing. Only
+// timeouts can be the caller's fault.
+func callerFault(ctx context.Context, err error, start time.Time, timeout time.Duration) bool {
+	if !errors.Is(err, ErrTimeout) && !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	if errors.Is(ctx.Err(), context.Canceled) {
+		return true
+	}
+	deadline, ok := ctx.Deadline()
+	return ok && deadline.Sub(start) < timeout/2
+}
+
+// BreakerStats is a snapshot of the circuit breaker of a backend.
+type BreakerStats struct {
+	State    string     `json:"state"`
+	Failures int        `json:"consecutive_failures"`
+	OpenedAt *time.Time `json:"opened_at,omitempty"`
+}
+
+func (b *circuitBreaker) stats() BreakerStats {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	stats := BreakerStats{State: b.state, Failures: b.failures}
+	if b.state != BreakerClosed {
+		openedAt := b.openedAt
+		stats.OpenedAt = &openedAt
+	}
+	return stats
+}
@@ -0,0 +1,155 @@
+package client
+
+import (
+	"backendify/pkg/models"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	breaker := newCircuitBreaker(models.BreakerConfig{
+		FailureThreshold: 2,
+		CoolDown:         time.Minute,
+		HalfOpenRequests: 1,
+	})
+	now := time.Now()
+
+	t.Run("Opens after consecutive failures", func(t *testing.T) {
+		assert.True(t, breaker.allow(now))
+		breaker.record(false, now)
+		assert.Equal(t, BreakerClosed, breaker.stats().State)
+
+		assert.True(t, breaker.allow(now))
+		breaker.record(false, now)
+		assert.Equal(t, BreakerOpen, breaker.stats().State)
+		assert.False(t, breaker.allow(now), "Expected calls to fail fast while open")
+	})
+
+	t.Run("Half-open trial failure reopens", func(t *testing.T) {
+		later := now.Add(time.Minute)
+		assert.True(t, breaker.allow(later), "Expected a trial call after the cool-down")
+		assert.Equal(t, BreakerHalfOpen, breaker.stats().State)
+		assert.False(t, breaker.allow(later), "Expected a single trial call")
+
+		breaker.record(false, later)
+		assert.Equal(t, BreakerOpen, breaker.stats().State)
+		now = later
+	})
+
+	t.Run("Forgone trial is given back", func(t *testing.T) {
+		later := now.Add(time.Minute)
+		assert.True(t, breaker.allow(later))
+		breaker.forgo()
+		assert.Equal(t, BreakerHalfOpen, breaker.stats().State)
+		assert.True(t, breaker.allow(later), "Expected the trial to be given back")
+		breaker.record(false, later)
+		now = later
+	})
+
+	t.Run("Half-open trial success closes", func(t *testing.T) {
+		later := now.Add(time.Minute)
+		assert.True(t, breaker.allow(later))
+		breaker.record(true, later)
+
+		stats := breaker.stats()
+		assert.Equal(t, BreakerClosed, stats.State)
+		assert.Equal(t, 0, stats.Failures)
+		assert.Nil(t, stats.OpenedAt)
+	})
+}
+
+func TestFetchAndCacheCircuitOpen(t *testing.T) {
+	var calls int32
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer backend.Close()
+
+	config := &models.Config{
+		Application: models.ApplicationConfig{CacheSize: 10},
+		Upstream: models.UpstreamConfig{
+			Breaker: models.BreakerConfig{FailureThreshold: 3, CoolDown: time.Minute},
+		},
+	}
+	bc, err := NewBackendClient(map[string]string{"ru": backend.URL}, config)
+	assert.NoError(t, err)
+
+	for i := 0; i < 5; i++ {
+		_, err = bc.fetchAndCache(context.Background(), cacheKey{country: "ru", id: "1"})
+	}
+	assert.ErrorIs(t, err, ErrCircuitOpen)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&calls), "Expected no backend calls while open")
+	assert.Equal(t, BreakerOpen, bc.Stats().Breakers["ru"].State)
+}
+
+func TestCallerFault(t *testing.T) {
+	start := time.Now()
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	queued, cancelQueued := context.WithDeadline(context.Background(), start.Add(100*time.Millisecond))
+	defer cancelQueued()
+	full, cancelFull := context.WithDeadline(context.Background(), start.Add(time.Second))
+	defer cancelFull()
+
+	testCases := []struct {
+		name     string
+		ctx      context.Context
+		err      error
+		expected bool
+	}{
+		{"Caller gave up", cancelled, ErrTimeout, true},
+		{"Call left too little time", queued, ErrTimeout, true},
+		{"Backend too slow", full, ErrTimeout, false},
+		{"Backend error", cancelled, ErrInvalidResponse, false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, callerFault(tc.ctx, tc.err, start, time.Second))
+		})
+	}
+}
+
+func TestFetchAndCacheCallerTimeout(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(time.Second):
+		case <-r.Context().Done():
+		}
+	}))
+	defer backend.Close()
+
+	config := &models.Config{
+		Application: models.ApplicationConfig{CacheSize: 10},
+		Upstream: models.UpstreamConfig{
+			RequestTimeout: 200 * time.Millisecond,
+			Breaker:        models.BreakerConfig{FailureThreshold: 1, CoolDown: time.Minute},
+			LoadBalancing:  models.LoadBalancingConfig{EjectAfter: 1, EjectFor: time.Minute},
+		},
+	}
+	bc, err := NewBackendClient(map[string]string{"ru": backend.URL}, config)
+	assert.NoError(t, err)
+	replica := bc.replicas["ru"].replicas[0]
+
+	// Most of the request timeout went elsewhere, as when queueing
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err = bc.fetchAndCache(ctx, cacheKey{country: "ru", id: "1"})
+	assert.ErrorIs(t, err, ErrTimeout)
+	assert.Equal(t, BreakerClosed, bc.Stats().Breakers["ru"].State, "Expected the timeout not to count against the backend")
+	assert.False(t, replica.ejected(time.Now()), "Expected the timeout not to count against the replica")
+
+	// The backend had the whole request timeout to answer
+	ctx, cancel = context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	_, err = bc.fetchAndCache(ctx, cacheKey{country: "ru", id: "1"})
+	assert.ErrorIs(t, err, ErrTimeout)
+	assert.Equal(t, BreakerOpen, bc.Stats().Breakers["ru"].State)
+	assert.True(t, replica.ejected(time.Now()))
+}
@@ -0,0 +1,127 @@
+package client
+
+import (
+	"backendify/pkg/models"
+	"sync/atomic"
+	"time"
+
+	lru "github.com/hashicorp/golang-lru"
+)
+
+// cacheKey identifies a company within the backend of a single country.
+type cacheKey struct {
+	country string
+	id      string
+}
+
+// cacheEntry is a cached lookup result. A nil company records that the
+// backend answered "not found".
+type cacheEntry struct {
+	company    *models.Company
+	refreshAt  time.Time // after this the entry is refreshed in the background
+	expiresAt  time.Time // after this the entry is no longer served as fresh
+	staleUntil time.Time // until this the entry may be served when the backend fails
+}
+
+// fresh reports whether the entry can be served as is.
+func (e cacheEntry) fresh(now time.Time) bool {
+	return now.Before(e.expiresAt)
+}
+
+// needsRefresh reports whether the entry is still fresh but due for a background refresh.
+func (e cacheEntry) needsRefresh(now time.Time) bool {
+	return !now.Before(e.refreshAt) && e.fresh(now)
+}
+
+// companyCache is an LRU cache of lookup results with a TTL per entry.
+type companyCache struct {
+	entries *lru.Cache
+
+	hits      atomic.Int64
+	misses    atomic.Int64
+	evictions atomic.Int64
+}
+
+func newCompanyCache(size int) (*companyCache, error) {
+	entries, err := lru.New(size)
+	if err != nil {
+		return nil, err
+	}
+	return &companyCache{entries: entries}, nil
+}
+
+// get returns the entry for key if it can still be served, fresh or stale.
+func (c *companyCache) get(key cacheKey, now time.Time) (cacheEntry, bool) {
+	value, found := c.entries.Get(key)
+	if !found {
+		return cacheEntry{}, false
+	}
+	entry := value.(cacheEntry)
+	if !now.Before(entry.staleUntil) {
+		c.entries.Remove(key)
+		return cacheEntry{}, false
+	}
+	return entry, true
+}
+
+// add caches a company, or a "not found" answer when company is nil.
+func (c *companyCache) add(key cacheKey, entry cacheEntry) {
+	if !entry.expiresAt.After(time.Now()) {
+		return
+	}
+	if evicted := c.entries.Add(key, entry); evicted {
+		c.evictions.Add(1)
+	}
+}
+
+// record counts a lookup answered from the cache, or not.
+func (c *companyCache) record(hit bool) {
+	if hit {
+		c.hits.Add(1)
+	} else {
+		c.misses.Add(1)
+	}
+}
+
+// CacheStats counts the lookups answered from the cache, and the entries
+// evicted to make room for newer ones.
+type CacheStats struct {
+	Size      int   `json:"size"`
+	Hits      int64 `json:"hits"`
+	Misses    int64 `json:"misses"`
+	Evictions int64 `json:"evictions"`
+}
+
+func (c *companyCache) stats() CacheStats {
+	return CacheStats{
+		Size:      c.entries.Len(),
+		Hits:      c.hits.Load(),
+		Misses:    c.misses.Load(),
+		Evictions: c.evictions.Load(),
+	}
+}
+
+// newCacheEntry builds the cache entry for a lookup result according to the
+// cache mode and the settings of the backend it came from.
+func newCacheEntry(company *models.Company, mode string, settings models.CountryUpstreamConfig, now time.Time) cacheEntry {
+	if company == nil {
+		expiresAt := now.Add(settings.NotFoundTTL)
+		return cacheEntry{refreshAt: expiresAt, expiresAt: expiresAt, staleUntil: expiresAt}
+	}
+
+	expiresAt := now.Add(settings.CacheTTL)
+	entry := cacheEntry{company: company, refreshAt: expiresAt, expiresAt: expiresAt, staleUntil: expiresAt}
+	if mode == models.CacheModeStaleWhileRevalidate {
+		entry.refreshAt = now.Add(settings.SoftTTL)
+		entry.staleUntil = expiresAt.Add(settings.MaxStale)
+	}
+	return entry
+}
+
+// withCurrentStatus returns a copy of company with Active recomputed from
+// ActiveUntil, so that a cached company never outlives its dissolution.
+func withCurrentStatus(company *models.Company) *models.Company {
+	current := *company
+	current.Active = !isClosedDateInThePast(company.ActiveUntil)
+	return &current
+}
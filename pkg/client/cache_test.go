@@ -0,0 +1,173 @@
+package client
+
+import (
+	"backendify/pkg/models"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompanyCache(t *testing.T) {
+	cache, err := newCompanyCache(10)
+	assert.NoError(t, err)
+	now := time.Now()
+	settings := models.CountryUpstreamConfig{CacheTTL: time.Minute}
+
+	t.Run("Keys are scoped by country", func(t *testing.T) {
+		company := &models.Company{ID: "1", Name: "US Company"}
+		cache.add(cacheKey{country: "us", id: "1"}, newCacheEntry(company, models.CacheModeStandard, settings, now))
+
+		entry, found := cache.get(cacheKey{country: "us", id: "1"}, now)
+		assert.True(t, found, "Expected a cached entry for us")
+		assert.Equal(t, "US Company", entry.company.Name)
+
+		_, found = cache.get(cacheKey{country: "ru", id: "1"}, now)
+		assert.False(t, found, "Expected no cached entry for ru")
+	})
+
+	t.Run("Entries expire", func(t *testing.T) {
+		key := cacheKey{country: "us", id: "2"}
+		cache.add(key, newCacheEntry(&models.Company{ID: "2"}, models.CacheModeStandard, settings, now))
+
+		_, found := cache.get(key, now.Add(time.Minute))
+		assert.False(t, found, "Expected the entry to have expired")
+	})
+
+	t.Run("Active is recomputed on read", func(t *testing.T) {
+		company := &models.Company{
+			ID:          "3",
+			Active:      true,
+			ActiveUntil: time.Now().Add(-time.Hour).Format(time.RFC3339),
+		}
+		current := withCurrentStatus(company)
+		assert.False(t, current.Active, "Expected a dissolved company to be inactive")
+		assert.True(t, company.Active, "Expected the cached company to be left untouched")
+	})
+}
+
+func TestLookupNegativeCaching(t *testing.T) {
+	var calls int32
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		if r.URL.Path == "/companies/missing" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/x-company-v2")
+		w.Write([]byte(`{"company_name":"Company Name","tin":"TIN123"}`))
+	}))
+	defer backend.Close()
+
+	config := &models.Config{
+		Application: models.ApplicationConfig{CacheSize: 10},
+		Upstream: models.UpstreamConfig{
+			NotFoundTTL: time.Minute,
+			Countries: map[string]models.CountryUpstreamConfig{
+				"ru": {CacheTTL: time.Minute},
+			},
+		},
+	}
+	bc, err := NewBackendClient(map[string]string{"us": backend.URL, "ru": backend.URL}, config)
+	assert.NoError(t, err)
+
+	lookup := func(country, id string) (*models.Company, error) {
+		return bc.lookup(requestInfo{ctx: context.Background(), country: country, id: id})
+	}
+
+	for i := 0; i < 2; i++ {
+		_, err := lookup("us", "missing")
+		assert.ErrorIs(t, err, ErrNotFound, "Expected a not found error")
+	}
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls), "Expected the not found answer to be cached")
+
+	for i := 0; i < 2; i++ {
+		company, err := lookup("ru", "1")
+		assert.NoError(t, err)
+		assert.Equal(t, "Company Name", company.Name)
+	}
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls), "Expected the company to be cached")
+
+	_, err = lookup("de", "1")
+	assert.ErrorIs(t, err, ErrUnknownBackend, "Expected an unknown backend error")
+}
+
+func TestLookupStaleWhileRevalidate(t *testing.T) {
+	var calls, failing int32
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		call := atomic.AddInt32(&calls, 1)
+		if atomic.LoadInt32(&failing) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "application/x-company-v1")
+		fmt.Fprintf(w, `{"cn":"Company %d","created_on":"2023-01-01T00:00:00Z"}`, call)
+	}))
+	defer backend.Close()
+
+	config := &models.Config{
+		Application: models.ApplicationConfig{CacheSize: 10},
+		Upstream: models.UpstreamConfig{
+			CacheMode: models.CacheModeStaleWhileRevalidate,
+			SoftTTL:   50 * time.Millisecond,
+			CacheTTL:  150 * time.Millisecond,
+			MaxStale:  time.Minute,
+		},
+	}
+	bc, err := NewBackendClient(map[string]string{"us": backend.URL}, config)
+	assert.NoError(t, err)
+
+	lookup := func() (*models.Company, error) {
+		return bc.lookup(requestInfo{ctx: context.Background(), country: "us", id: "1"})
+	}
+
+	company, err := lookup()
+	assert.NoError(t, err)
+	assert.Equal(t, "Company 1", company.Name)
+
+	// Past the soft TTL the cached company is served while it is refreshed
+	time.Sleep(60 * time.Millisecond)
+	company, err = lookup()
+	assert.NoError(t, err)
+	assert.Equal(t, "Company 1", company.Name)
+	assert.Eventually(t, func() bool {
+		company, _ := lookup()
+		return company.Name == "Company 2"
+	}, time.Second, 10*time.Millisecond, "Expected the company to be refreshed in the background")
+
+	// Past the TTL a failing backend gets the expired company served instead
+	atomic.StoreInt32(&failing, 1)
+	time.Sleep(160 * time.Millisecond)
+	company, err = lookup()
+	assert.NoError(t, err)
+	assert.Equal(t, "Company 2", company.Name)
+	assert.True(t, company.Stale, "Expected the company to be marked as stale")
+}
+
+func TestNewBackendClientUnknownCacheMode(t *testing.T) {
+	config := &models.Config{
+		Application: models.ApplicationConfig{CacheSize: 10},
+		Upstream:    models.UpstreamConfig{CacheMode: "forever"},
+	}
+	_, err := NewBackendClient(nil, config)
+	assert.ErrorIs(t, err, ErrUnknownMode)
+}
+
+func TestCacheStats(t *testing.T) {
+	cache, err := newCompanyCache(1)
+	assert.NoError(t, err)
+	now := time.Now()
+	settings := models.UpstreamConfig{}.For("us")
+
+	cache.add(cacheKey{country: "us", id: "1"}, newCacheEntry(&models.Company{ID: "1"}, models.CacheModeStandard, settings, now))
+	cache.add(cacheKey{country: "us", id: "2"}, newCacheEntry(&models.Company{ID: "2"}, models.CacheModeStandard, settings, now))
+	cache.record(true)
+	cache.record(false)
+
+	assert.Equal(t, CacheStats{Size: 1, Hits: 1, Misses: 1, Evictions: 1}, cache.stats())
+}
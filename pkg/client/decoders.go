@@ -0,0 +1,185 @@
+package client
+
+import (
+	"backendify/pkg/models"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"sort"
+	"strings"
+	"sync"
+)
+
+var ErrUnsupportedContentType = errors.New("unsupported content type")
+
+// Decoder turns the body of a backend response into a company. The caller
+// sets the company ID, so decoders only map the vendor schema.
+type Decoder func(body []byte) (*models.Company, error)
+
+// DecoderRegistry holds the decoders of the backend responses, keyed by
+// media type and optionally by its version parameter.
+type DecoderRegistry struct {
+	mu       sync.RWMutex
+	decoders map[string]Decoder
+}
+
+// NewDecoderRegistry returns an empty registry.
+func NewDecoderRegistry() *DecoderRegistry {
+	return &DecoderRegistry{decoders: make(map[string]Decoder)}
+}
+
+// DefaultDecoders is the registry used by ParseCompanyResponse, with the
+// built-in vendor schemas registered. Backend clients decode with a snapshot
+// of it taken by NewBackendClient, so decoders must be registered before.
+var DefaultDecoders = NewDecoderRegistry()
+
+func init() {
+	for mediaType, decoder := range map[string]Decoder{
+		"application/x-company-v1":         decodeV1,
+		"application/x-company; version=1": decodeV1,
+		"application/x-company-v2":         decodeV2,
+		"application/x-company; version=2": decodeV2,
+	} {
+		if err := DefaultDecoders.Register(mediaType, decoder); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// Clone returns a registry with the same decoders, which can be extended
+// without affecting r.
+func (r *DecoderRegistry) Clone() *DecoderRegistry {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	clone := NewDecoderRegistry()
+	for key, decoder := range r.decoders {
+		clone.decoders[key] = decoder
+	}
+	return clone
+}
+
+// RegisterDecoder registers a decoder on the default registry, for the
+// backend clients created afterwards.
+func RegisterDecoder(mediaType string, decoder Decoder) error {
+	return DefaultDecoders.Register(mediaType, decoder)
+}
+
+// Register adds a decoder for a media type, replacing any decoder already
+// registered for it. A version parameter, as in "application/x-company;
+// version=3", restricts the decoder to that version; without it the decoder
+// handles every version not registered on its own.
+func (r *DecoderRegistry) Register(mediaType string, decoder Decoder) error {
+	key, err := decoderKey(mediaType)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.decoders[key] = decoder
+	return nil
+}
+
+// Decode decodes a response body with the decoder registered for its content type.
+func (r *DecoderRegistry) Decode(contentType string, body []byte, id string) (*models.Company, error) {
+	decoder, format, err := r.lookup(contentType)
+	if err != nil {
+		return nil, err
+	}
+
+	company, err := decoder(body)
+	if err != nil {
+		if errors.Is(err, ErrBadPayload) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("%w: %v", ErrBadPayload, err)
+	}
+	if company == nil {
+		return nil, fmt.Errorf("%w: no company in %s response", ErrBadPayload, contentType)
+	}
+	company.ID = id
+	company.Format = format
+	return company, nil
+}
+
+// lookup returns the decoder of a content type, and the media type and
+// version of the content, which identify the format the company came in.
+func (r *DecoderRegistry) lookup(contentType string) (Decoder, string, error) {
+	if mediaType, params, err := mime.ParseMediaType(contentType); err == nil {
+		format := mediaTypeKey(mediaType, params["version"])
+		r.mu.RLock()
+		decoder, ok := r.decoders[format]
+		if !ok {
+			decoder, ok = r.decoders[mediaType]
+		}
+		r.mu.RUnlock()
+		if ok {
+			return decoder, format, nil
+		}
+	}
+	return nil, "", fmt.Errorf("%w: %w %q, supported: %s", ErrBadPayload, ErrUnsupportedContentType, contentType, strings.Join(r.Supported(), ", "))
+}
+
+// Supported lists the registered media types.
+func (r *DecoderRegistry) Supported() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	supported := make([]string, 0, len(r.decoders))
+	for key := range r.decoders {
+		supported = append(supported, key)
+	}
+	sort.Strings(supported)
+	return supported
+}
+
+func decoderKey(mediaType string) (string, error) {
+	parsed, params, err := mime.ParseMediaType(mediaType)
+	if err != nil {
+		return "", fmt.Errorf("invalid media type %q: %w", mediaType, err)
+	}
+	return mediaTypeKey(parsed, params["version"]), nil
+}
+
+func mediaTypeKey(mediaType, version string) string {
+	if version == "" {
+		return mediaType
+	}
+	return mediaType + "; version=" + version
+}
+
+func decodeV1(body []byte) (*models.Company, error) {
+	var v1Response struct {
+		CN        string `json:"cn"`
+		CreatedOn string `json:"created_on"`
+		ClosedOn  string `json:"closed_on,omitempty"`
+	}
+	if err := json.Unmarshal(body, &v1Response); err != nil {
+		return nil, err
+	}
+	return &models.Company{
+		Name:           v1Response.CN,
+		Active:         v1Response.ClosedOn == "" || !isClosedDateInThePast(v1Response.ClosedOn),
+		ActiveUntil:    v1Response.ClosedOn,
+		IncorporatedOn: v1Response.CreatedOn,
+	}, nil
+}
+
+func decodeV2(body []byte) (*models.Company, error) {
+	var v2Response struct {
+		CompanyName string `json:"company_name"`
+		TIN         string `json:"tin"`
+		DissolvedOn string `json:"dissolved_on,omitempty"`
+	}
+	if err := json.Unmarshal(body, &v2Response); err != nil {
+		return nil, err
+	}
+	return &models.Company{
+		Name:        v2Response.CompanyName,
+		Active:      v2Response.DissolvedOn == "" || !isClosedDateInThePast(v2Response.DissolvedOn),
+		ActiveUntil: v2Response.DissolvedOn,
+		TaxID:       v2Response.TIN,
+	}, nil
+}
@@ -0,0 +1,66 @@
+package client
+
+import (
+	"backendify/pkg/models"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecoderRegistry(t *testing.T) {
+	registry := NewDecoderRegistry()
+	decodeV3 := func(body []byte) (*models.Company, error) {
+		var v3Response struct {
+			LegalName string `json:"legal_name"`
+		}
+		if err := json.Unmarshal(body, &v3Response); err != nil {
+			return nil, err
+		}
+		return &models.Company{Name: v3Response.LegalName, Active: true}, nil
+	}
+	assert.NoError(t, registry.Register("application/x-company; version=3", decodeV3))
+	assert.NoError(t, registry.Register("application/x-company-v1", decodeV1))
+
+	t.Run("Versioned media type", func(t *testing.T) {
+		company, err := registry.Decode(`application/x-company; charset=utf-8; version="3"`, []byte(`{"legal_name":"Acme"}`), "42")
+		assert.NoError(t, err)
+		assert.Equal(t, &models.Company{ID: "42", Name: "Acme", Active: true, Format: "application/x-company; version=3"}, company)
+	})
+
+	t.Run("Media type without version", func(t *testing.T) {
+		company, err := registry.Decode("Application/X-Company-V1", []byte(`{"cn":"Acme"}`), "42")
+		assert.NoError(t, err)
+		assert.Equal(t, "Acme", company.Name)
+	})
+
+	t.Run("Unknown media type lists the supported ones", func(t *testing.T) {
+		_, err := registry.Decode("application/x-company; version=4", []byte(`{}`), "42")
+		assert.ErrorIs(t, err, ErrUnsupportedContentType)
+		assert.ErrorIs(t, err, ErrBadPayload)
+		assert.Contains(t, err.Error(), "application/x-company-v1, application/x-company; version=3")
+	})
+
+	t.Run("Decoder errors are bad payloads", func(t *testing.T) {
+		_, err := registry.Decode("application/x-company; version=3", []byte(`not json`), "42")
+		assert.ErrorIs(t, err, ErrBadPayload)
+	})
+
+	t.Run("Invalid media type is rejected", func(t *testing.T) {
+		assert.Error(t, registry.Register("not a media type;;", decodeV1))
+	})
+}
+
+func TestDefaultDecoders(t *testing.T) {
+	company, err := DefaultDecoders.Decode("application/x-company; version=2", []byte(`{"company_name":"Acme","tin":"US-123"}`), "7")
+	assert.NoError(t, err)
+	assert.Equal(t, "Acme", company.Name)
+	assert.Equal(t, "US-123", company.TaxID)
+	assert.Equal(t, "application/x-company; version=2", company.Format)
+
+	company, err = DefaultDecoders.Decode("application/x-company-v1", []byte(`{"cn":"Acme","created_on":"2001-02-03T00:00:00Z"}`), "7")
+	assert.NoError(t, err)
+	assert.Equal(t, "2001-02-03T00:00:00Z", company.IncorporatedOn)
+	assert.Equal(t, "application/x-company-v1", company.Format)
+	assert.Contains(t, DefaultDecoders.Supported(), "application/x-company-v1")
+}
@@ -0,0 +1,37 @@
+package client
+
+import "errors"
+
+// ErrorKind classifies why a lookup failed, so that callers can tell a
+// company that does not exist from a backend worth retrying later.
+type ErrorKind string
+
+const (
+	// KindNotFound means the company does not exist, or the country has no backend.
+	KindNotFound ErrorKind = "not_found"
+	// KindUnavailable means the backend failed or is known to be down.
+	KindUnavailable ErrorKind = "upstream_unavailable"
+	// KindTimeout means the backend did not answer within the deadline.
+	KindTimeout ErrorKind = "upstream_timeout"
+	// KindBadPayload means the backend answered with a company that could not be decoded.
+	KindBadPayload ErrorKind = "bad_payload"
+	// KindOverloaded means the lookup was shed before reaching the backend.
+	KindOverloaded ErrorKind = "overloaded"
+)
+
+// KindOf classifies an error returned by a CompanyFetcher. Errors the
+// client does not know about are treated as an unavailable backend.
+func KindOf(err error) ErrorKind {
+	switch {
+	case errors.Is(err, ErrNotFound), errors.Is(err, ErrUnknownBackend):
+		return KindNotFound
+	case errors.Is(err, ErrTimeout):
+		return KindTimeout
+	case errors.Is(err, ErrOverloaded), errors.Is(err, ErrPoolStopped):
+		return KindOverloaded
+	case errors.Is(err, ErrBadPayload):
+		return KindBadPayload
+	default:
+		return KindUnavailable
+	}
+}
@@ -0,0 +1,40 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/valyala/fasthttp"
+)
+
+func TestKindOf(t *testing.T) {
+	tests := []struct {
+		err  error
+		want ErrorKind
+	}{
+		{ErrNotFound, KindNotFound},
+		{ErrUnknownBackend, KindNotFound},
+		{fmt.Errorf("%w: context deadline exceeded", ErrTimeout), KindTimeout},
+		{ErrOverloaded, KindOverloaded},
+		{ErrPoolStopped, KindOverloaded},
+		{fmt.Errorf("%w: unexpected end of JSON input", ErrBadPayload), KindBadPayload},
+		{&StatusError{StatusCode: 500}, KindUnavailable},
+		{ErrCircuitOpen, KindUnavailable},
+		{errors.New("connection refused"), KindUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.err.Error(), func(t *testing.T) {
+			assert.Equal(t, tt.want, KindOf(tt.err))
+		})
+	}
+
+	t.Run("Undecodable responses are bad payloads", func(t *testing.T) {
+		resp := &fasthttp.Response{}
+		resp.Header.SetContentType("application/x-company-v1")
+		resp.SetBody([]byte(`{"cn":`))
+		_, err := ParseCompanyResponse(resp, "123")
+		assert.Equal(t, KindBadPayload, KindOf(err))
+	})
+}
@@ -0,0 +1,138 @@
+package client
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+// replicaHealth is the outcome of the latest health check of a replica.
+type replicaHealth struct {
+	mu          sync.Mutex
+	healthy     bool
+	lastChecked time.Time
+	lastError   string
+}
+
+func (h *replicaHealth) set(err error, now time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.healthy = err == nil
+	h.lastChecked = now
+	h.lastError = ""
+	if err != nil {
+		h.lastError = err.Error()
+	}
+}
+
+func (h *replicaHealth) isHealthy() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.healthy
+}
+
+// runHealthChecks probes every replica at the configured interval until stop is closed.
+func (bc *BackendClient) runHealthChecks(stop <-chan struct{}) {
+	defer bc.wg.Done()
+
+	ticker := time.NewTicker(bc.upstream.HealthCheck.Interval)
+	defer ticker.Stop()
+
+	for {
+		bc.checkReplicas()
+		select {
+		case <-ticker.C:
+		case <-stop:
+			return
+		}
+	}
+}
+
+// checkReplicas probes all replicas concurrently and waits for the results.
+func (bc *BackendClient) checkReplicas() {
+	var wg sync.WaitGroup
+	for _, set := range bc.replicas {
+		for _, r := range set.replicas {
+			wg.Add(1)
+			go func(r *replica) {
+				defer wg.Done()
+				r.health.set(bc.probe(r.url), time.Now())
+			}(r)
+		}
+	}
+	wg.Wait()
+}
+
+// probe requests the health check path of a replica and checks the status it answers with.
+func (bc *BackendClient) probe(url string) error {
+	req := fasthttp.AcquireRequest()
+	resp := fasthttp.AcquireResponse()
+	defer fasthttp.ReleaseRequest(req)
+	defer fasthttp.ReleaseResponse(resp)
+
+	config := bc.upstream.HealthCheck
+	req.SetRequestURI(url + config.Path)
+	if err := bc.httpClient.DoTimeout(req, resp, config.Timeout); err != nil {
+		return err
+	}
+	if resp.StatusCode() != config.ExpectedStatus {
+		return fmt.Errorf("unexpected status %d, expected %d", resp.StatusCode(), config.ExpectedStatus)
+	}
+	return nil
+}
+
+// ReplicaHealth is the health of a replica of a country backend.
+type ReplicaHealth struct {
+	URL         string     `json:"url"`
+	Healthy     bool       `json:"healthy"`
+	LastChecked *time.Time `json:"last_checked,omitempty"`
+	LastError   string     `json:"last_error,omitempty"`
+}
+
+// CountryHealth is the health of a country backend, which is healthy as long
+// as one of its replicas is.
+type CountryHealth struct {
+	Healthy  bool            `json:"healthy"`
+	Replicas []ReplicaHealth `json:"replicas"`
+}
+
+// HealthReport is the health of all country backends.
+type HealthReport struct {
+	Healthy   bool                     `json:"healthy"`
+	Countries map[string]CountryHealth `json:"countries"`
+}
+
+// Health reports the health of every country backend as of the latest checks.
+// Without active health checks every backend is reported healthy.
+func (bc *BackendClient) Health() HealthReport {
+	report := HealthReport{Healthy: true, Countries: make(map[string]CountryHealth, len(bc.replicas))}
+
+	countries := make([]string, 0, len(bc.replicas))
+	for country := range bc.replicas {
+		countries = append(countries, country)
+	}
+	sort.Strings(countries)
+
+	for _, country := range countries {
+		var health CountryHealth
+		for _, r := range bc.replicas[country].replicas {
+			r.health.mu.Lock()
+			replica := ReplicaHealth{URL: r.url, Healthy: r.health.healthy, LastError: r.health.lastError}
+			if !r.health.lastChecked.IsZero() {
+				lastChecked := r.health.lastChecked
+				replica.LastChecked = &lastChecked
+			}
+			r.health.mu.Unlock()
+
+			health.Healthy = health.Healthy || replica.Healthy
+			health.Replicas = append(health.Replicas, replica)
+		}
+		report.Healthy = report.Healthy && health.Healthy
+		report.Countries[country] = health
+	}
+	return report
+}
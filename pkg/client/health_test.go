@@ -0,0 +1,53 @@
+package client
+
+import (
+	"backendify/pkg/config"
+	"backendify/pkg/models"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHealthChecks(t *testing.T) {
+	healthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/healthz" {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer healthy.Close()
+	unhealthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer unhealthy.Close()
+
+	backends := config.BackendConfig{
+		"us": unhealthy.URL + "," + healthy.URL,
+		"ru": unhealthy.URL,
+	}
+	appConfig := &models.Config{
+		Application: models.ApplicationConfig{CacheSize: 10},
+		Upstream: models.UpstreamConfig{
+			HealthCheck: models.HealthCheckConfig{Enabled: true, Path: "/healthz", Interval: time.Minute},
+		},
+	}
+	bc, err := NewBackendClient(backends, appConfig)
+	assert.NoError(t, err)
+
+	assert.True(t, bc.Health().Healthy, "Expected backends to be healthy before the first check")
+
+	bc.checkReplicas()
+	report := bc.Health()
+	assert.False(t, report.Healthy, "Expected the service to be unhealthy while ru is down")
+	assert.True(t, report.Countries["us"].Healthy, "Expected us to be healthy with one healthy replica")
+	assert.False(t, report.Countries["ru"].Healthy)
+	assert.Contains(t, report.Countries["ru"].Replicas[0].LastError, "unexpected status 500")
+	assert.NotNil(t, report.Countries["ru"].Replicas[0].LastChecked)
+
+	// Unhealthy replicas are taken out of rotation
+	for i := 0; i < 4; i++ {
+		assert.Equal(t, healthy.URL, bc.replicas["us"].pick(nil, time.Now()).url)
+	}
+}
@@ -0,0 +1,179 @@
+package client
+
+import (
+	"backendify/pkg/models"
+	"context"
+	"errors"
+	"math"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// minHedgeSamples is the number of observed latencies needed before a backend gets hedged.
+const minHedgeSamples = 10
+
+// latencyTracker keeps the recent latencies of a backend and its hedging counters.
+type latencyTracker struct {
+	mu      sync.Mutex
+	samples []time.Duration
+	next    int
+
+	requests atomic.Int64
+	hedges   atomic.Int64
+	wins     atomic.Int64
+}
+
+func newLatencyTracker(window int) *latencyTracker {
+	return &latencyTracker{samples: make([]time.Duration, 0, window)}
+}
+
+func (t *latencyTracker) observe(latency time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if len(t.samples) < cap(t.samples) {
+		t.samples = append(t.samples, latency)
+		return
+	}
+	t.samples[t.next] = latency
+	t.next = (t.next + 1) % len(t.samples)
+}
+
+// percentile returns the given percentile of the recent latencies, or false
+// while too few of them have been observed.
+func (t *latencyTracker) percentile(p float64) (time.Duration, bool) {
+	t.mu.Lock()
+	sorted := make([]time.Duration, len(t.samples))
+	copy(sorted, t.samples)
+	t.mu.Unlock()
+
+	if len(sorted) < minHedgeSamples {
+		return 0, false
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	index := int(math.Ceil(p/100*float64(len(sorted)))) - 1
+	if index < 0 {
+		index = 0
+	}
+	return sorted[index], true
+}
+
+// hedgeDelay returns how long to wait for the first request before hedging it.
+func (t *latencyTracker) hedgeDelay(config models.HedgingConfig) (time.Duration, bool) {
+	delay, ok := t.percentile(config.Percentile)
+	if !ok {
+		return 0, false
+	}
+	if delay < config.MinDelay {
+		delay = config.MinDelay
+	}
+	return delay, true
+}
+
+// allowHedge reserves a hedge unless that would push the share of hedged requests over the cap.
+func (t *latencyTracker) allowHedge(maxRatio float64) bool {
+	for {
+		hedges := t.hedges.Load()
+		if float64(hedges+1) > maxRatio*float64(t.requests.Load()) {
+			return false
+		}
+		// Retry if a concurrent request reserved a hedge in the meantime
+		if t.hedges.CompareAndSwap(hedges, hedges+1) {
+			return true
+		}
+	}
+}
+
+// tracker returns the latency tracker of a backend.
+func (bc *BackendClient) tracker(backendURL string) *latencyTracker {
+	if t, ok := bc.latencies.Load(backendURL); ok {
+		return t.(*latencyTracker)
+	}
+	t, _ := bc.latencies.LoadOrStore(backendURL, newLatencyTracker(bc.hedging.Window))
+	return t.(*latencyTracker)
+}
+
+// fetch requests a company from a backend. With hedging enabled, a second
+// identical request is sent if the first one is slower than the configured
+// percentile of the backend latency. The first answer wins; fasthttp cannot
+// abort a request in flight, so the other one is abandoned and its answer dropped.
+func (bc *BackendClient) fetch(ctx context.Context, backendURL, id string) (*models.Company, error) {
+	if !bc.hedging.Enabled {
+		return bc.fetchOnce(ctx, backendURL, id)
+	}
+
+	tracker := bc.tracker(backendURL)
+	tracker.requests.Add(1)
+
+	type hedgeResult struct {
+		fetchResult
+		hedge bool
+	}
+	results := make(chan hedgeResult, 2)
+	send := func(hedge bool) {
+		start := time.Now()
+		company, err := bc.fetchOnce(ctx, backendURL, id)
+		if err == nil || errors.Is(err, ErrNotFound) {
+			tracker.observe(time.Since(start))
+		}
+		results <- hedgeResult{fetchResult{company: company, err: err}, hedge}
+	}
+	go send(false)
+
+	pending := 1
+	if delay, ok := tracker.hedgeDelay(bc.hedging); ok {
+		timer := time.NewTimer(delay)
+		defer timer.Stop()
+
+		select {
+		case result := <-results:
+			return result.company, result.err
+		case <-timer.C:
+			if tracker.allowHedge(bc.hedging.MaxRatio) {
+				go send(true)
+				pending++
+			}
+		}
+	}
+
+	// Take the first definitive answer, or the last failure
+	var result hedgeResult
+	for ; pending > 0; pending-- {
+		result = <-results
+		if result.err == nil || errors.Is(result.err, ErrNotFound) {
+			break
+		}
+	}
+	if result.hedge {
+		tracker.wins.Add(1)
+	}
+	return result.company, result.err
+}
+
+// HedgingStats is a snapshot of the hedging counters of a backend.
+type HedgingStats struct {
+	Requests int64  `json:"requests"`
+	Hedges   int64  `json:"hedges"`
+	Wins     int64  `json:"hedge_wins"`
+	Delay    string `json:"hedge_delay,omitempty"`
+}
+
+func (bc *BackendClient) hedgingStats() map[string]HedgingStats {
+	stats := make(map[string]HedgingStats)
+	bc.latencies.Range(func(key, value interface{}) bool {
+		t := value.(*latencyTracker)
+		s := HedgingStats{
+			Requests: t.requests.Load(),
+			Hedges:   t.hedges.Load(),
+			Wins:     t.wins.Load(),
+		}
+		if delay, ok := t.hedgeDelay(bc.hedging); ok {
+			s.Delay = delay.String()
+		}
+		stats[key.(string)] = s
+		return true
+	})
+	return stats
+}
@@ -0,0 +1,95 @@
+package client
+
+import (
+	"backendify/pkg/models"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLatencyTracker(t *testing.T) {
+	tracker := newLatencyTracker(20)
+
+	_, ok := tracker.percentile(95)
+	assert.False(t, ok, "Expected no percentile without samples")
+
+	for i := 1; i <= 40; i++ {
+		tracker.observe(time.Duration(i) * time.Millisecond)
+	}
+	p50, ok := tracker.percentile(50)
+	assert.True(t, ok)
+	assert.Equal(t, 30*time.Millisecond, p50, "Expected only the most recent samples to count")
+
+	delay, ok := tracker.hedgeDelay(models.HedgingConfig{Percentile: 50, MinDelay: time.Second})
+	assert.True(t, ok)
+	assert.Equal(t, time.Second, delay, "Expected the delay to be at least the minimum")
+
+	tracker.requests.Add(10)
+	assert.True(t, tracker.allowHedge(0.2))
+	assert.True(t, tracker.allowHedge(0.2))
+	assert.False(t, tracker.allowHedge(0.2), "Expected hedges to be capped at the ratio")
+}
+
+func TestAllowHedgeConcurrent(t *testing.T) {
+	tracker := newLatencyTracker(20)
+	tracker.requests.Add(100)
+
+	var allowed atomic.Int64
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if tracker.allowHedge(0.1) {
+				allowed.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int64(10), allowed.Load(), "Expected concurrent hedges to stay within the cap")
+	assert.Equal(t, int64(10), tracker.hedges.Load())
+}
+
+func TestFetchHedged(t *testing.T) {
+	var calls int32
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) == minHedgeSamples+1 {
+			time.Sleep(500 * time.Millisecond)
+		}
+		w.Header().Set("Content-Type", "application/x-company-v1")
+		w.Write([]byte(`{"cn":"Company Name","created_on":"2023-01-01T00:00:00Z"}`))
+	}))
+	defer backend.Close()
+
+	config := &models.Config{
+		Application: models.ApplicationConfig{CacheSize: 10},
+		Upstream: models.UpstreamConfig{
+			Hedging: models.HedgingConfig{Enabled: true, MinDelay: 20 * time.Millisecond, MaxRatio: 1},
+		},
+	}
+	bc, err := NewBackendClient(nil, config)
+	assert.NoError(t, err)
+
+	// Warm up the latency percentile
+	for i := 0; i < minHedgeSamples; i++ {
+		_, err := bc.fetch(context.Background(), backend.URL, "1")
+		assert.NoError(t, err)
+	}
+
+	start := time.Now()
+	company, err := bc.fetch(context.Background(), backend.URL, "1")
+	assert.NoError(t, err)
+	assert.Equal(t, "Company Name", company.Name)
+	assert.Less(t, time.Since(start), 300*time.Millisecond, "Expected the hedge to answer first")
+
+	stats := bc.Stats().Hedging[backend.URL]
+	assert.Equal(t, int64(minHedgeSamples+1), stats.Requests)
+	assert.Equal(t, int64(1), stats.Hedges)
+	assert.Equal(t, int64(1), stats.Wins)
+}
@@ -0,0 +1,121 @@
+package client
+
+import (
+	"backendify/pkg/models"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrInvalidMapping = errors.New("invalid response mapping")
+
+// errNoValue is returned for a path that is missing from a document or null.
+var errNoValue = errors.New("no value")
+
+// newMappingDecoder builds the decoder of a response format declared in the configuration.
+func newMappingDecoder(mapping models.ResponseMapping) (Decoder, error) {
+	if mapping.NamePath == "" {
+		return nil, fmt.Errorf("%w for %q: no name path", ErrInvalidMapping, mapping.MediaType)
+	}
+	layout := mapping.DateLayout
+	if layout == "" {
+		layout = time.RFC3339
+	}
+
+	return func(body []byte) (*models.Company, error) {
+		var document interface{}
+		if err := json.Unmarshal(body, &document); err != nil {
+			return nil, err
+		}
+
+		name, err := stringAt(document, mapping.NamePath)
+		if err != nil {
+			return nil, err
+		}
+		company := &models.Company{Name: name, Active: true}
+		if mapping.TaxIDPath != "" {
+			// Details are optional, a missing one is left empty
+			company.TaxID, _ = stringAt(document, mapping.TaxIDPath)
+		}
+		if mapping.IncorporatedOnPath != "" {
+			if company.IncorporatedOn, err = dateAt(document, mapping.IncorporatedOnPath, layout); err != nil {
+				return nil, fmt.Errorf("incorporation date: %w", err)
+			}
+		}
+		if mapping.DissolvedOnPath != "" {
+			if company.ActiveUntil, err = dateAt(document, mapping.DissolvedOnPath, layout); err != nil {
+				return nil, fmt.Errorf("dissolution date: %w", err)
+			}
+			company.Active = !isClosedDateInThePast(company.ActiveUntil)
+		}
+		return company, nil
+	}, nil
+}
+
+// dateAt returns the date at a path of a JSON document in the format of the
+// built-in schemas, or an empty string when the document has no such date.
+// A value that is not a string is an error, not a missing date, so that a
+// mapping pointed at the wrong field does not report every company active.
+func dateAt(document interface{}, path, layout string) (string, error) {
+	value, err := stringAt(document, path)
+	if errors.Is(err, errNoValue) || (err == nil && value == "") {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	date, err := time.Parse(layout, value)
+	if err != nil {
+		return "", err
+	}
+	return date.Format(time.RFC3339), nil
+}
+
+// stringAt returns the string at a dot-separated path of a JSON document.
+// Path segments index objects by key and arrays by position.
+func stringAt(document interface{}, path string) (string, error) {
+	value := document
+	for _, segment := range strings.Split(path, ".") {
+		switch node := value.(type) {
+		case map[string]interface{}:
+			value = node[segment]
+		case []interface{}:
+			index, err := strconv.Atoi(segment)
+			if err != nil || index < 0 || index >= len(node) {
+				return "", fmt.Errorf("%w: no element %q at %q", errNoValue, segment, path)
+			}
+			value = node[index]
+		default:
+			value = nil
+		}
+		if value == nil {
+			return "", fmt.Errorf("%w at %q", errNoValue, path)
+		}
+	}
+
+	s, ok := value.(string)
+	if !ok {
+		return "", fmt.Errorf("%w: value at %q is not a string", ErrBadPayload, path)
+	}
+	return s, nil
+}
+
+// newRegistry returns a copy of the default decoders with the configured
+// mappings registered. It is a copy even without mappings, so that a client
+// decodes the same media types whatever its configuration.
+func newRegistry(mappings []models.ResponseMapping) (*DecoderRegistry, error) {
+	registry := DefaultDecoders.Clone()
+	for _, mapping := range mappings {
+		decoder, err := newMappingDecoder(mapping)
+		if err != nil {
+			return nil, err
+		}
+		if err := registry.Register(mapping.MediaType, decoder); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidMapping, err)
+		}
+	}
+	return registry, nil
+}
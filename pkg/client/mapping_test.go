@@ -0,0 +1,112 @@
+package client
+
+import (
+	"backendify/pkg/models"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMappingDecoder(t *testing.T) {
+	decoder, err := newMappingDecoder(models.ResponseMapping{
+		MediaType:       "application/x-company; version=3",
+		NamePath:        "data.names.0",
+		DissolvedOnPath: "data.dissolution.date",
+		DateLayout:      "2006-01-02",
+		TaxIDPath:       "data.tin",
+	})
+	assert.NoError(t, err)
+
+	t.Run("Dissolved company", func(t *testing.T) {
+		company, err := decoder([]byte(`{"data":{"names":["Acme"],"dissolution":{"date":"2001-02-03"}}}`))
+		assert.NoError(t, err)
+		assert.Equal(t, &models.Company{Name: "Acme", Active: false, ActiveUntil: "2001-02-03T00:00:00Z"}, company)
+	})
+
+	t.Run("Active company", func(t *testing.T) {
+		company, err := decoder([]byte(`{"data":{"names":["Acme"],"tin":"US-123"}}`))
+		assert.NoError(t, err)
+		assert.Equal(t, &models.Company{Name: "Acme", Active: true, TaxID: "US-123"}, company)
+	})
+
+	t.Run("Missing name", func(t *testing.T) {
+		_, err := decoder([]byte(`{"data":{"names":[]}}`))
+		assert.Error(t, err)
+	})
+
+	t.Run("Date in another layout", func(t *testing.T) {
+		_, err := decoder([]byte(`{"data":{"names":["Acme"],"dissolution":{"date":"03/02/2001"}}}`))
+		assert.Error(t, err)
+	})
+
+	t.Run("Null date", func(t *testing.T) {
+		company, err := decoder([]byte(`{"data":{"names":["Acme"],"dissolution":{"date":null}}}`))
+		assert.NoError(t, err)
+		assert.True(t, company.Active, "Expected a null date to mean no dissolution")
+	})
+
+	t.Run("Date that is not a string", func(t *testing.T) {
+		for _, date := range []string{`981158400`, `{"year":2001}`} {
+			_, err := decoder([]byte(`{"data":{"names":["Acme"],"dissolution":{"date":` + date + `}}}`))
+			assert.ErrorIs(t, err, ErrBadPayload, "Expected %s to be rejected rather than read as no date", date)
+		}
+	})
+
+	t.Run("Mapping without name path", func(t *testing.T) {
+		_, err := newMappingDecoder(models.ResponseMapping{MediaType: "application/x-company; version=3"})
+		assert.ErrorIs(t, err, ErrInvalidMapping)
+	})
+}
+
+func TestConfiguredMappings(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/x-company; version=3")
+		w.Write([]byte(`{"legal_name":"Acme"}`))
+	}))
+	defer backend.Close()
+
+	config := &models.Config{
+		Application: models.ApplicationConfig{CacheSize: 100, Workers: 1},
+		Upstream: models.UpstreamConfig{
+			Mappings: []models.ResponseMapping{{MediaType: "application/x-company; version=3", NamePath: "legal_name"}},
+		},
+	}
+	bc, err := NewBackendClient(map[string]string{"us": backend.URL}, config)
+	assert.NoError(t, err)
+	bc.StartWorkers()
+	defer bc.StopWorkers()
+
+	company, err := bc.FetchCompanyData(context.Background(), "us", "1")
+	assert.NoError(t, err)
+	assert.Equal(t, "Acme", company.Name)
+	assert.Equal(t, "us", company.Country)
+	assert.False(t, company.FetchedAt.IsZero())
+
+	// The default registry is left alone
+	assert.NotContains(t, DefaultDecoders.Supported(), "application/x-company; version=3")
+}
+
+func TestRegistrySnapshot(t *testing.T) {
+	const mediaType = "application/x-company-snapshot"
+	decoder := func(body []byte) (*models.Company, error) {
+		return &models.Company{}, nil
+	}
+
+	config := &models.Config{Application: models.ApplicationConfig{CacheSize: 10}}
+	plain, err := NewBackendClient(map[string]string{"us": "http://localhost:9001"}, config)
+	assert.NoError(t, err)
+	config.Upstream.Mappings = []models.ResponseMapping{{MediaType: "application/x-company; version=3", NamePath: "legal_name"}}
+	mapped, err := NewBackendClient(map[string]string{"us": "http://localhost:9001"}, config)
+	assert.NoError(t, err)
+
+	assert.NoError(t, RegisterDecoder(mediaType, decoder))
+	assert.NotContains(t, plain.decoders.Supported(), mediaType, "Expected a client without mappings to keep its snapshot")
+	assert.NotContains(t, mapped.decoders.Supported(), mediaType, "Expected a client with mappings to keep its snapshot")
+
+	later, err := NewBackendClient(map[string]string{"us": "http://localhost:9001"}, config)
+	assert.NoError(t, err)
+	assert.Contains(t, later.decoders.Supported(), mediaType)
+}
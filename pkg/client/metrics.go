@@ -0,0 +1,70 @@
+package client
+
+import (
+	"backendify/pkg/metrics"
+	"errors"
+	"time"
+)
+
+// upstreamMetrics measures the calls to the country backends.
+type upstreamMetrics struct {
+	latency *metrics.HistogramVec
+	errors  *metrics.CounterVec
+}
+
+func newUpstreamMetrics() upstreamMetrics {
+	return upstreamMetrics{
+		latency: metrics.NewHistogramVec("backendify_upstream_request_duration_seconds",
+			"Time spent fetching a company from its country backend, retries and failover included.",
+			metrics.DefaultBuckets, "country"),
+		errors: metrics.NewCounterVec("backendify_upstream_errors_total",
+			"Failed fetches from the country backends, by kind of failure.",
+			"country", "kind"),
+	}
+}
+
+// observe records a fetch from a country backend. A "not found" answer is not a failure.
+func (m upstreamMetrics) observe(country string, duration time.Duration, err error) {
+	m.latency.Observe(duration.Seconds(), country)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		m.errors.Inc(country, string(KindOf(err)))
+	}
+}
+
+// Collectors returns the metrics of the client: the upstream calls, the
+// cache and the worker pool.
+func (bc *BackendClient) Collectors() []metrics.Collector {
+	cache := func(value func(CacheStats) int64) func() []metrics.Sample {
+		return func() []metrics.Sample {
+			return []metrics.Sample{{Value: float64(value(bc.cache.stats()))}}
+		}
+	}
+	pool := func(value func(PoolStats) int64) func() []metrics.Sample {
+		return func() []metrics.Sample {
+			return []metrics.Sample{{Value: float64(value(bc.poolStats()))}}
+		}
+	}
+
+	return []metrics.Collector{
+		bc.upstreamMetrics.latency,
+		bc.upstreamMetrics.errors,
+		metrics.NewCounterFunc("backendify_cache_hits_total", "Lookups answered from the cache.", nil,
+			cache(func(s CacheStats) int64 { return s.Hits })),
+		metrics.NewCounterFunc("backendify_cache_misses_total", "Lookups not answered from the cache.", nil,
+			cache(func(s CacheStats) int64 { return s.Misses })),
+		metrics.NewCounterFunc("backendify_cache_evictions_total", "Cache entries evicted to make room for newer ones.", nil,
+			cache(func(s CacheStats) int64 { return s.Evictions })),
+		metrics.NewGaugeFunc("backendify_cache_entries", "Entries in the cache.", nil,
+			cache(func(s CacheStats) int64 { return int64(s.Size) })),
+		metrics.NewGaugeFunc("backendify_pool_workers", "Workers in the pool.", nil,
+			pool(func(s PoolStats) int64 { return s.Size })),
+		metrics.NewGaugeFunc("backendify_pool_busy_workers", "Workers handling a lookup.", nil,
+			pool(func(s PoolStats) int64 { return s.Busy })),
+		metrics.NewGaugeFunc("backendify_pool_idle_workers", "Workers waiting for a lookup.", nil,
+			pool(func(s PoolStats) int64 { return s.Idle })),
+		metrics.NewGaugeFunc("backendify_pool_queued_lookups", "Lookups waiting for a worker.", nil,
+			pool(func(s PoolStats) int64 { return s.QueueDepth })),
+		metrics.NewCounterFunc("backendify_pool_shed_lookups_total", "Lookups shed because the pool was overloaded.", nil,
+			pool(func(s PoolStats) int64 { return s.Shed })),
+	}
+}
@@ -1,7 +1,9 @@
 package mocks
 
 import (
+	"backendify/pkg/client"
 	"backendify/pkg/models"
+	"context"
 	"math/rand"
 	"time"
 )
@@ -67,7 +69,7 @@ type MockBackendClient struct {
 }
 
 // Returns a random Company from the mock data.
-func (m MockBackendClient) FetchCompanyData(backendURL, id string) (*models.Company, error) {
+func (m MockBackendClient) FetchCompanyData(ctx context.Context, country, id string) (*models.Company, error) {
 	var customRand = rand.New(rand.NewSource(time.Now().UnixNano()))
 
 	randomIndex := customRand.Intn(len(mockData))
@@ -85,3 +87,11 @@ func (m MockBackendClient) StopWorkers() {
 func (m MockBackendClient) WorkersAvailable() bool {
 	return true
 }
+
+func (m MockBackendClient) Stats() client.Stats {
+	return client.Stats{}
+}
+
+func (m MockBackendClient) Health() client.HealthReport {
+	return client.HealthReport{Healthy: true}
+}
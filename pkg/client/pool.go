@@ -0,0 +1,283 @@
+package client
+
+import (
+	"backendify/pkg/models"
+	"backendify/pkg/tracing"
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultQueueDepth is the number of requests that may wait for a worker when no depth is configured.
+const DefaultQueueDepth = 100
+
+// Priority orders the requests waiting for a worker.
+type Priority int
+
+const (
+	// PriorityHigh is used for interactive lookups, and is the default.
+	PriorityHigh Priority = iota
+	// PriorityLow is used for batch jobs and other background work, which
+	// only gets a worker when no interactive lookup is waiting.
+	PriorityLow
+
+	priorityLevels = 2
+)
+
+type priorityKey struct{}
+
+// WithPriority returns a context whose lookups are queued with the given priority.
+func WithPriority(ctx context.Context, priority Priority) context.Context {
+	return context.WithValue(ctx, priorityKey{}, priority)
+}
+
+func priorityFrom(ctx context.Context) Priority {
+	if priority, ok := ctx.Value(priorityKey{}).(Priority); ok && priority >= 0 && priority < priorityLevels {
+		return priority
+	}
+	return PriorityHigh
+}
+
+// Queued request states, so that a worker and a caller that stops waiting
+// agree on who owns the request.
+const (
+	requestQueued int32 = iota
+	requestTaken
+	requestAbandoned
+)
+
+// poolCounters tracks the size and load of the worker pool.
+type poolCounters struct {
+	running atomic.Bool
+	size    atomic.Int64
+	busy    atomic.Int64
+	queued  atomic.Int64
+	shed    atomic.Int64
+
+	// Load observed since the last autoscaling sample
+	completed atomic.Int64
+	busyTime  atomic.Int64
+	queueWait atomic.Int64
+
+	// Averages of the last autoscaling sample
+	lastWait    atomic.Int64
+	lastLatency atomic.Int64
+}
+
+// startWorker adds a worker to the pool.
+func (bc *BackendClient) startWorker() {
+	bc.wg.Add(1)
+	bc.pool.size.Add(1)
+	go bc.worker()
+}
+
+// enqueue queues a request for the worker pool and waits for its result.
+// The request is shed with ErrOverloaded when the queue is full or when no
+// worker picks it up within the maximum queue wait.
+func (bc *BackendClient) enqueue(ctx context.Context, priority Priority, country, id string) (*models.Company, LookupInfo, error) {
+	if !bc.pool.running.Load() {
+		return nil, LookupInfo{}, ErrPoolStopped
+	}
+	if bc.pool.queued.Add(1) > bc.queueDepth {
+		bc.pool.queued.Add(-1)
+		bc.pool.shed.Add(1)
+		return nil, LookupInfo{}, ErrOverloaded
+	}
+
+	// Buffered so that a worker never blocks on a caller that already gave up
+	resultChan := make(chan fetchResult, 1)
+	_, queueSpan := tracing.Start(ctx, "queue")
+	req := requestInfo{
+		ctx:        ctx,
+		country:    country,
+		id:         id,
+		result:     resultChan,
+		state:      new(atomic.Int32),
+		enqueuedAt: time.Now(),
+		queueSpan:  queueSpan,
+	}
+	select {
+	case bc.queues[priority] <- req:
+	default:
+		// The queue is clogged with requests whose callers gave up, and that
+		// no worker has skipped yet
+		bc.pool.queued.Add(-1)
+		bc.pool.shed.Add(1)
+		queueSpan.SetError(ErrOverloaded)
+		queueSpan.End()
+		return nil, LookupInfo{}, ErrOverloaded
+	}
+
+	var queueTimeout <-chan time.Time
+	if bc.queueWait > 0 {
+		timer := time.NewTimer(bc.queueWait)
+		defer timer.Stop()
+		queueTimeout = timer.C
+	}
+
+	for {
+		select {
+		case result := <-resultChan:
+			return result.company, result.info, result.err
+		case <-queueTimeout:
+			if bc.abandon(req) {
+				bc.pool.shed.Add(1)
+				err := fmt.Errorf("%w: no worker within %v", ErrOverloaded, bc.queueWait)
+				queueSpan.SetError(err)
+				queueSpan.End()
+				return nil, LookupInfo{}, err
+			}
+			// A worker took the request just in time, wait for its result
+			queueTimeout = nil
+		case <-ctx.Done():
+			err := fmt.Errorf("%w: %v", ErrTimeout, ctx.Err())
+			if bc.abandon(req) {
+				queueSpan.SetError(err)
+				queueSpan.End()
+			}
+			// A worker that took the request skips the lookup, since ctx is done
+			return nil, LookupInfo{}, err
+		}
+	}
+}
+
+// abandon withdraws a request that no worker took yet, freeing its place in
+// the queue at once. The request stays in its channel until a worker skips it.
+func (bc *BackendClient) abandon(req requestInfo) bool {
+	if !req.state.CompareAndSwap(requestQueued, requestAbandoned) {
+		return false
+	}
+	bc.pool.queued.Add(-1)
+	return true
+}
+
+func (bc *BackendClient) worker() {
+	defer bc.wg.Done()
+	defer bc.pool.size.Add(-1)
+	for {
+		req, more := bc.next()
+		if !more {
+			// The pool is stopped or shrinking, so the worker can exit.
+			return
+		}
+		if !req.state.CompareAndSwap(requestQueued, requestTaken) {
+			// The caller stopped waiting for a worker
+			continue
+		}
+		bc.pool.queued.Add(-1)
+
+		req.queueSpan.End()
+		start := time.Now()
+		bc.pool.queueWait.Add(int64(start.Sub(req.enqueuedAt)))
+		bc.pool.busy.Add(1)
+		bc.handle(req)
+		bc.pool.busy.Add(-1)
+		bc.pool.busyTime.Add(int64(time.Since(start)))
+		bc.pool.completed.Add(1)
+	}
+}
+
+// next takes the next request off the queues, preferring higher priorities.
+func (bc *BackendClient) next() (requestInfo, bool) {
+	for _, queue := range bc.queues {
+		select {
+		case req := <-queue:
+			return req, true
+		default:
+		}
+	}
+
+	// Nothing is waiting, take whatever comes first
+	select {
+	case req := <-bc.queues[PriorityHigh]:
+		return req, true
+	case req := <-bc.queues[PriorityLow]:
+		return req, true
+	case <-bc.retire:
+		return requestInfo{}, false
+	case <-bc.stop:
+		return requestInfo{}, false
+	}
+}
+
+// drain fails the requests left in the queues once the workers have stopped.
+func (bc *BackendClient) drain() {
+	for _, queue := range bc.queues {
+		for len(queue) > 0 {
+			req := <-queue
+			if !req.state.CompareAndSwap(requestQueued, requestTaken) {
+				continue
+			}
+			bc.pool.queued.Add(-1)
+			req.queueSpan.SetError(ErrPoolStopped)
+			req.queueSpan.End()
+			req.result <- fetchResult{err: ErrPoolStopped}
+		}
+	}
+}
+
+// handle answers a single request taken from the pool.
+func (bc *BackendClient) handle(req requestInfo) {
+	if err := req.ctx.Err(); err != nil {
+		// The caller already gave up, don't spend a backend call on it
+		req.result <- fetchResult{err: fmt.Errorf("%w: %v", ErrTimeout, err)}
+		return
+	}
+
+	// The info is the worker's own, the caller may stop waiting at any time
+	var info LookupInfo
+	req.ctx = WithLookupInfo(req.ctx, &info)
+	company, err := bc.lookup(req)
+	req.result <- fetchResult{company: company, info: info, err: err}
+}
+
+// PoolStats is a snapshot of the worker pool.
+type PoolStats struct {
+	Running       bool    `json:"running"`
+	Size          int64   `json:"size"`
+	MinSize       int64   `json:"min_size"`
+	MaxSize       int64   `json:"max_size"`
+	Autoscaling   bool    `json:"autoscaling"`
+	Busy          int64   `json:"busy"`
+	Idle          int64   `json:"idle"`
+	QueueDepth    int64   `json:"queue_depth"`
+	QueueCapacity int64   `json:"queue_capacity"`
+	Shed          int64   `json:"shed"`
+	Saturation    float64 `json:"saturation"`
+	// Averages over the last autoscaling interval
+	QueueWait string `json:"queue_wait,omitempty"`
+	Latency   string `json:"latency,omitempty"`
+}
+
+func (bc *BackendClient) poolStats() PoolStats {
+	size := bc.pool.size.Load()
+	busy := bc.pool.busy.Load()
+	if busy > size {
+		// A worker may be counted busy just before it is counted started
+		busy = size
+	}
+
+	stats := PoolStats{
+		Running:       bc.pool.running.Load(),
+		Size:          size,
+		MinSize:       int64(bc.workers),
+		MaxSize:       int64(bc.workers),
+		Autoscaling:   bc.autoscale.Enabled,
+		Busy:          busy,
+		Idle:          size - busy,
+		QueueDepth:    bc.pool.queued.Load(),
+		QueueCapacity: bc.queueDepth,
+		Shed:          bc.pool.shed.Load(),
+	}
+	if size > 0 {
+		stats.Saturation = float64(busy) / float64(size)
+	}
+	if bc.autoscale.Enabled {
+		stats.MinSize = int64(bc.autoscale.MinWorkers)
+		stats.MaxSize = int64(bc.autoscale.MaxWorkers)
+		stats.QueueWait = time.Duration(bc.pool.lastWait.Load()).String()
+		stats.Latency = time.Duration(bc.pool.lastLatency.Load()).String()
+	}
+	return stats
+}
@@ -0,0 +1,214 @@
+package client
+
+import (
+	"backendify/pkg/models"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPoolAccounting(t *testing.T) {
+	release := make(chan struct{})
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/companies/slow" {
+			<-release
+		}
+		w.Header().Set("Content-Type", "application/x-company-v1")
+		w.Write([]byte(`{"cn":"Company Name","created_on":"2023-01-01T00:00:00Z"}`))
+	}))
+	defer backend.Close()
+
+	config := &models.Config{
+		Application: models.ApplicationConfig{
+			CacheSize: 100,
+			Workers:   2,
+		},
+	}
+	bc, err := NewBackendClient(map[string]string{"us": backend.URL}, config)
+	assert.NoError(t, err)
+	assert.False(t, bc.WorkersAvailable(), "Expected no workers before the pool is started")
+
+	bc.StartWorkers()
+
+	t.Run("Sequential requests do not drift", func(t *testing.T) {
+		for i := 0; i < 20; i++ {
+			_, err := bc.FetchCompanyData(context.Background(), "us", strconv.Itoa(i))
+			assert.NoError(t, err)
+		}
+		stats := bc.Stats().Pool
+		assert.Equal(t, PoolStats{Running: true, Size: 2, MinSize: 2, MaxSize: 2, Idle: 2, QueueCapacity: DefaultQueueDepth}, stats)
+		assert.True(t, bc.WorkersAvailable())
+	})
+
+	t.Run("Busy workers are counted", func(t *testing.T) {
+		done := make(chan struct{})
+		go func() {
+			bc.FetchCompanyData(context.Background(), "us", "slow")
+			close(done)
+		}()
+
+		assert.Eventually(t, func() bool {
+			return bc.Stats().Pool.Busy == 1
+		}, time.Second, 5*time.Millisecond)
+		stats := bc.Stats().Pool
+		assert.Equal(t, int64(1), stats.Idle)
+		assert.Equal(t, 0.5, stats.Saturation)
+
+		close(release)
+		<-done
+		assert.Eventually(t, func() bool {
+			return bc.Stats().Pool.Busy == 0
+		}, time.Second, 5*time.Millisecond)
+	})
+
+	bc.StopWorkers()
+	assert.False(t, bc.WorkersAvailable(), "Expected no workers once the pool is stopped")
+	assert.Equal(t, int64(0), bc.Stats().Pool.Size)
+}
+
+func TestPoolQueue(t *testing.T) {
+	release := make(chan struct{})
+	var order []string
+	var mu sync.Mutex
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/companies/blocker" {
+			<-release
+		} else {
+			mu.Lock()
+			order = append(order, strings.TrimPrefix(r.URL.Path, "/companies/"))
+			mu.Unlock()
+		}
+		w.Header().Set("Content-Type", "application/x-company-v1")
+		w.Write([]byte(`{"cn":"Company Name","created_on":"2023-01-01T00:00:00Z"}`))
+	}))
+	defer backend.Close()
+
+	config := &models.Config{
+		Application: models.ApplicationConfig{
+			CacheSize:  100,
+			Workers:    1,
+			QueueDepth: 2,
+		},
+	}
+	bc, err := NewBackendClient(map[string]string{"us": backend.URL}, config)
+	assert.NoError(t, err)
+	bc.StartWorkers()
+	defer bc.StopWorkers()
+	// Released before the workers are stopped, so none is left blocked
+	defer close(release)
+
+	// Keep the only worker busy
+	go bc.FetchCompanyData(context.Background(), "us", "blocker")
+	assert.Eventually(t, func() bool { return bc.Stats().Pool.Busy == 1 }, time.Second, 5*time.Millisecond)
+
+	var wg sync.WaitGroup
+	lookup := func(ctx context.Context, id string) {
+		defer wg.Done()
+		_, err := bc.FetchCompanyData(ctx, "us", id)
+		assert.NoError(t, err)
+	}
+
+	wg.Add(2)
+	go lookup(WithPriority(context.Background(), PriorityLow), "batch")
+	assert.Eventually(t, func() bool { return bc.Stats().Pool.QueueDepth == 1 }, time.Second, 5*time.Millisecond)
+	go lookup(context.Background(), "interactive")
+	assert.Eventually(t, func() bool { return bc.Stats().Pool.QueueDepth == 2 }, time.Second, 5*time.Millisecond)
+
+	t.Run("Full queue sheds load", func(t *testing.T) {
+		_, err := bc.FetchCompanyData(context.Background(), "us", "shed")
+		assert.ErrorIs(t, err, ErrOverloaded)
+		assert.False(t, bc.WorkersAvailable(), "Expected a saturated pool not to be ready")
+		assert.Equal(t, int64(1), bc.Stats().Pool.Shed)
+	})
+
+	t.Run("Interactive lookups go first", func(t *testing.T) {
+		release <- struct{}{}
+		wg.Wait()
+		assert.Equal(t, []string{"interactive", "batch"}, order)
+	})
+}
+
+func TestPoolMaxQueueWait(t *testing.T) {
+	release := make(chan struct{})
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer backend.Close()
+
+	config := &models.Config{
+		Application: models.ApplicationConfig{
+			CacheSize:    100,
+			Workers:      1,
+			MaxQueueWait: 50 * time.Millisecond,
+		},
+	}
+	bc, err := NewBackendClient(map[string]string{"us": backend.URL}, config)
+	assert.NoError(t, err)
+	bc.StartWorkers()
+	defer bc.StopWorkers()
+	// Released before the workers are stopped, so none is left blocked
+	defer close(release)
+
+	go bc.FetchCompanyData(context.Background(), "us", "blocker")
+	assert.Eventually(t, func() bool { return bc.Stats().Pool.Busy == 1 }, time.Second, 5*time.Millisecond)
+
+	start := time.Now()
+	_, err = bc.FetchCompanyData(context.Background(), "us", "waiting")
+	assert.ErrorIs(t, err, ErrOverloaded)
+	assert.Less(t, time.Since(start), 500*time.Millisecond, "Expected the lookup to be shed after the maximum queue wait")
+}
+
+func TestPoolAbandonedLookup(t *testing.T) {
+	release := make(chan struct{})
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/companies/blocker" {
+			<-release
+		}
+		w.Header().Set("Content-Type", "application/x-company-v1")
+		w.Write([]byte(`{"cn":"Company Name","created_on":"2023-01-01T00:00:00Z"}`))
+	}))
+	defer backend.Close()
+
+	config := &models.Config{
+		Application: models.ApplicationConfig{
+			CacheSize:  100,
+			Workers:    1,
+			QueueDepth: 1,
+		},
+	}
+	bc, err := NewBackendClient(map[string]string{"us": backend.URL}, config)
+	assert.NoError(t, err)
+	bc.StartWorkers()
+	defer bc.StopWorkers()
+
+	// Keep the only worker busy
+	go bc.FetchCompanyData(context.Background(), "us", "blocker")
+	assert.Eventually(t, func() bool { return bc.Stats().Pool.Busy == 1 }, time.Second, 5*time.Millisecond)
+
+	// The caller gives up while its lookup is queued
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err = bc.FetchCompanyData(ctx, "us", "abandoned")
+	assert.ErrorIs(t, err, ErrTimeout)
+	assert.Eventually(t, func() bool { return bc.Stats().Pool.QueueDepth == 0 }, time.Second, 5*time.Millisecond,
+		"Expected the abandoned lookup to free its place in the queue")
+
+	done := make(chan error)
+	go func() {
+		_, err := bc.FetchCompanyData(context.Background(), "us", "waiting")
+		done <- err
+	}()
+	assert.Eventually(t, func() bool { return bc.Stats().Pool.QueueDepth == 1 }, time.Second, 5*time.Millisecond)
+
+	close(release)
+	assert.NoError(t, <-done, "Expected the lookup to be queued rather than shed")
+	assert.Equal(t, int64(0), bc.Stats().Pool.Shed)
+}
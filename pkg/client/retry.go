@@ -0,0 +1,79 @@
+package client
+
+import (
+	"backendify/pkg/models"
+	"context"
+	"errors"
+	"io"
+	"math"
+	"math/rand"
+	"syscall"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+// fetchWithRetry fetches a company, retrying transient failures according to
+// policy for as long as the deadline of ctx allows.
+func (bc *BackendClient) fetchWithRetry(ctx context.Context, policy models.RetryConfig, backendURL, id string) (*models.Company, error) {
+	for attempt := 1; ; attempt++ {
+		company, err := bc.fetch(ctx, backendURL, id)
+		if err == nil || attempt >= policy.MaxAttempts || !isRetryable(err, policy) {
+			return company, err
+		}
+
+		if !sleep(ctx, backoff(policy, attempt)) {
+			// Waiting any longer would overrun the deadline, report the last failure
+			return nil, err
+		}
+	}
+}
+
+// isRetryable reports whether err is a transient failure worth another attempt.
+// A "not found" answer is definitive and never retried.
+func isRetryable(err error, policy models.RetryConfig) bool {
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		for _, status := range policy.RetryableStatuses {
+			if statusErr.StatusCode == status {
+				return true
+			}
+		}
+		return false
+	}
+
+	return errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, fasthttp.ErrConnectionClosed)
+}
+
+// backoff returns the delay before the given retry: exponential growth from
+// the initial backoff, capped at the max backoff, spread by the jitter fraction.
+func backoff(policy models.RetryConfig, attempt int) time.Duration {
+	delay := float64(policy.InitialBackoff) * math.Pow(2, float64(attempt-1))
+	if limit := float64(policy.MaxBackoff); limit > 0 && delay > limit {
+		delay = limit
+	}
+	if policy.Jitter != nil && *policy.Jitter > 0 {
+		delay *= 1 + *policy.Jitter*(2*rand.Float64()-1)
+	}
+	return time.Duration(delay)
+}
+
+// sleep waits for d unless ctx is done first or its deadline is closer than d.
+func sleep(ctx context.Context, d time.Duration) bool {
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < d {
+		return false
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
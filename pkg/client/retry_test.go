@@ -0,0 +1,107 @@
+package client
+
+import (
+	"backendify/pkg/models"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFetchWithRetry(t *testing.T) {
+	var calls int32
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		call := atomic.AddInt32(&calls, 1)
+		switch {
+		case r.URL.Path == "/companies/missing":
+			w.WriteHeader(http.StatusNotFound)
+		case r.URL.Path == "/companies/broken" || call < 3:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		default:
+			w.Header().Set("Content-Type", "application/x-company-v1")
+			w.Write([]byte(`{"cn":"Company Name","created_on":"2023-01-01T00:00:00Z"}`))
+		}
+	}))
+	defer backend.Close()
+
+	bc, err := NewBackendClient(nil, &models.Config{Application: models.ApplicationConfig{CacheSize: 10}})
+	assert.NoError(t, err)
+
+	policy := models.RetryConfig{
+		MaxAttempts:       3,
+		InitialBackoff:    10 * time.Millisecond,
+		MaxBackoff:        20 * time.Millisecond,
+		RetryableStatuses: []int{503},
+	}
+
+	t.Run("Transient failures are retried", func(t *testing.T) {
+		atomic.StoreInt32(&calls, 0)
+		company, err := bc.fetchWithRetry(context.Background(), policy, backend.URL, "1")
+		assert.NoError(t, err, "Expected the third attempt to succeed")
+		assert.Equal(t, "Company Name", company.Name)
+		assert.Equal(t, int32(3), atomic.LoadInt32(&calls))
+	})
+
+	t.Run("Not found is never retried", func(t *testing.T) {
+		atomic.StoreInt32(&calls, 0)
+		_, err := bc.fetchWithRetry(context.Background(), policy, backend.URL, "missing")
+		assert.ErrorIs(t, err, ErrNotFound)
+		assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+	})
+
+	t.Run("Attempts are bounded", func(t *testing.T) {
+		atomic.StoreInt32(&calls, 0)
+		_, err := bc.fetchWithRetry(context.Background(), policy, backend.URL, "broken")
+		var statusErr *StatusError
+		assert.ErrorAs(t, err, &statusErr)
+		assert.Equal(t, http.StatusServiceUnavailable, statusErr.StatusCode)
+		assert.Equal(t, int32(3), atomic.LoadInt32(&calls))
+	})
+
+	t.Run("Retries stay within the deadline", func(t *testing.T) {
+		atomic.StoreInt32(&calls, 0)
+		slow := policy
+		slow.InitialBackoff = time.Second
+		slow.MaxBackoff = time.Second
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+
+		start := time.Now()
+		_, err := bc.fetchWithRetry(ctx, slow, backend.URL, "broken")
+		assert.Error(t, err)
+		assert.Less(t, time.Since(start), 100*time.Millisecond, "Expected no retry past the deadline")
+		assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+	})
+}
+
+func TestBackoff(t *testing.T) {
+	jitter := 0.5
+	policy := models.RetryConfig{
+		InitialBackoff: 100 * time.Millisecond,
+		MaxBackoff:     300 * time.Millisecond,
+		Jitter:         &jitter,
+	}
+
+	for attempt, expected := range map[int]time.Duration{1: 100 * time.Millisecond, 2: 200 * time.Millisecond, 5: 300 * time.Millisecond} {
+		delay := backoff(policy, attempt)
+		assert.GreaterOrEqual(t, delay, expected/2, "Expected the delay to stay within the jitter")
+		assert.LessOrEqual(t, delay, expected*3/2, "Expected the delay to stay within the jitter")
+	}
+}
+
+func TestBackoffWithoutJitter(t *testing.T) {
+	noJitter := 0.0
+	upstream := models.UpstreamConfig{
+		Retry: models.RetryConfig{InitialBackoff: 100 * time.Millisecond, Jitter: &noJitter},
+	}
+	policy := upstream.For("us").Retry
+	assert.Equal(t, 0.0, *policy.Jitter, "Expected a jitter of 0 to be kept rather than defaulted")
+	assert.Equal(t, 200*time.Millisecond, backoff(policy, 2), "Expected the exact delay without jitter")
+
+	defaults := models.UpstreamConfig{}.For("us").Retry
+	assert.Equal(t, 0.2, *defaults.Jitter, "Expected the default jitter when unset")
+}
@@ -0,0 +1,52 @@
+package client
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Stats is a snapshot of the internal state of a CompanyFetcher.
+type Stats struct {
+	Pool       PoolStats                 `json:"pool"`
+	Cache      CacheStats                `json:"cache"`
+	Coalescing CoalescingStats           `json:"coalescing"`
+	Breakers   map[string]BreakerStats   `json:"breakers"`
+	Hedging    map[string]HedgingStats   `json:"hedging"`
+	Replicas   map[string][]ReplicaStats `json:"replicas"`
+}
+
+// CoalescingStats counts how many lookups were collapsed into a shared upstream request.
+type CoalescingStats struct {
+	Lookups   int64 `json:"lookups"`
+	Upstream  int64 `json:"upstream"`
+	Collapsed int64 `json:"collapsed"`
+}
+
+type coalescingCounters struct {
+	lookups   atomic.Int64
+	upstream  atomic.Int64
+	collapsed atomic.Int64
+}
+
+// Stats returns a snapshot of the client counters.
+func (bc *BackendClient) Stats() Stats {
+	stats := Stats{
+		Pool:  bc.poolStats(),
+		Cache: bc.cache.stats(),
+		Coalescing: CoalescingStats{
+			Lookups:   bc.coalescing.lookups.Load(),
+			Upstream:  bc.coalescing.upstream.Load(),
+			Collapsed: bc.coalescing.collapsed.Load(),
+		},
+		Breakers: make(map[string]BreakerStats, len(bc.breakers)),
+		Hedging:  bc.hedgingStats(),
+		Replicas: make(map[string][]ReplicaStats, len(bc.replicas)),
+	}
+	for country, breaker := range bc.breakers {
+		stats.Breakers[country] = breaker.stats()
+	}
+	for country, set := range bc.replicas {
+		stats.Replicas[country] = set.stats(time.Now())
+	}
+	return stats
+}
@@ -1,12 +1,22 @@
 package config
 
 import (
+	"strconv"
 	"strings"
 )
 
 // BackendConfig represents the configuration for backends.
+// A country may be served by several replicas, given as comma-separated URLs.
 type BackendConfig map[string]string
 
+// Replica is one upstream URL serving a country.
+type Replica struct {
+	URL    string
+	Weight int
+}
+
+// LoadBackends parses "iso=url" arguments. Repeating an ISO code adds a replica
+// for that country, and a URL may be followed by ";weight=N" for weighted balancing.
 func LoadBackends(args []string) BackendConfig {
 	argsMap := make(map[string]string)
 
@@ -16,9 +26,33 @@ func LoadBackends(args []string) BackendConfig {
 		if len(parts) == 2 {
 			key := parts[0]
 			value := parts[1]
+			if existing, ok := argsMap[key]; ok {
+				value = existing + "," + value
+			}
 			argsMap[key] = value
 		}
 	}
 
 	return argsMap
 }
+
+// Replicas returns the replicas configured for a country.
+func (bc BackendConfig) Replicas(country string) []Replica {
+	var replicas []Replica
+	for _, entry := range strings.Split(bc[country], ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		replica := Replica{URL: entry, Weight: 1}
+		if i := strings.Index(entry, ";weight="); i >= 0 {
+			replica.URL = entry[:i]
+			if weight, err := strconv.Atoi(entry[i+len(";weight="):]); err == nil && weight > 0 {
+				replica.Weight = weight
+			}
+		}
+		replicas = append(replicas, replica)
+	}
+	return replicas
+}
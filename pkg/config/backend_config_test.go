@@ -1,6 +1,7 @@
 package config
 
 import (
+	"reflect"
 	"testing"
 )
 
@@ -26,3 +27,31 @@ func TestLoadBackends(t *testing.T) {
 		t.Errorf("Test case 2: Length mismatch. Expected %v, but got %v", expected2, actual2)
 	}
 }
+
+func TestReplicas(t *testing.T) {
+	backends := LoadBackends([]string{
+		"us=http://localhost:9001",
+		"us=http://localhost:9002;weight=3",
+		"ru=http://localhost:9003,http://localhost:9004;weight=x",
+	})
+
+	expectedUS := []Replica{
+		{URL: "http://localhost:9001", Weight: 1},
+		{URL: "http://localhost:9002", Weight: 3},
+	}
+	if actual := backends.Replicas("us"); !reflect.DeepEqual(expectedUS, actual) {
+		t.Errorf("Repeated ISO code: Expected %v, but got %v", expectedUS, actual)
+	}
+
+	expectedRU := []Replica{
+		{URL: "http://localhost:9003", Weight: 1},
+		{URL: "http://localhost:9004", Weight: 1},
+	}
+	if actual := backends.Replicas("ru"); !reflect.DeepEqual(expectedRU, actual) {
+		t.Errorf("Comma-separated URLs: Expected %v, but got %v", expectedRU, actual)
+	}
+
+	if actual := backends.Replicas("de"); len(actual) != 0 {
+		t.Errorf("Unknown ISO code: Expected no replicas, but got %v", actual)
+	}
+}
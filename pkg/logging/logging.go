@@ -0,0 +1,55 @@
+// Package logging sets up the application logger and the files the logs are
+// written to.
+package logging
+
+import (
+	"backendify/pkg/models"
+	"errors"
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Log formats.
+const (
+	FormatLogfmt = "logfmt"
+	FormatJSON   = "json"
+)
+
+var ErrUnknownFormat = errors.New("unknown log format")
+
+// NewFormatter returns the formatter of the given log format.
+func NewFormatter(format string) (logrus.Formatter, error) {
+	switch format {
+	case FormatLogfmt:
+		// Without colors, the text formatter writes logfmt
+		return &logrus.TextFormatter{DisableColors: true, FullTimestamp: true}, nil
+	case FormatJSON:
+		return &logrus.JSONFormatter{}, nil
+	}
+	return nil, fmt.Errorf("%w: %q", ErrUnknownFormat, format)
+}
+
+// Level returns the lowest level logged, which debug mode lowers to debug.
+func Level(level string, debug bool) (logrus.Level, error) {
+	if debug {
+		return logrus.DebugLevel, nil
+	}
+	return logrus.ParseLevel(level)
+}
+
+// Configure sets the level and format of logger from the configuration.
+func Configure(logger *logrus.Logger, config models.LoggingConfig, debug bool) error {
+	config = config.WithDefaults()
+	formatter, err := NewFormatter(config.Format)
+	if err != nil {
+		return err
+	}
+	level, err := Level(config.Level, debug)
+	if err != nil {
+		return err
+	}
+	logger.SetFormatter(formatter)
+	logger.SetLevel(level)
+	return nil
+}
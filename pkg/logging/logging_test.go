@@ -0,0 +1,36 @@
+package logging
+
+import (
+	"backendify/pkg/models"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConfigure(t *testing.T) {
+	t.Run("Defaults", func(t *testing.T) {
+		logger := logrus.New()
+		assert.NoError(t, Configure(logger, models.LoggingConfig{}, false))
+		assert.Equal(t, logrus.InfoLevel, logger.GetLevel())
+		assert.IsType(t, &logrus.TextFormatter{}, logger.Formatter)
+	})
+
+	t.Run("JSON", func(t *testing.T) {
+		logger := logrus.New()
+		assert.NoError(t, Configure(logger, models.LoggingConfig{Level: "warn", Format: FormatJSON}, false))
+		assert.Equal(t, logrus.WarnLevel, logger.GetLevel())
+		assert.IsType(t, &logrus.JSONFormatter{}, logger.Formatter)
+	})
+
+	t.Run("Debug mode", func(t *testing.T) {
+		logger := logrus.New()
+		assert.NoError(t, Configure(logger, models.LoggingConfig{Level: "error"}, true))
+		assert.Equal(t, logrus.DebugLevel, logger.GetLevel(), "Expected debug mode to lower the level")
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		assert.ErrorIs(t, Configure(logrus.New(), models.LoggingConfig{Format: "xml"}, false), ErrUnknownFormat)
+		assert.Error(t, Configure(logrus.New(), models.LoggingConfig{Level: "loud"}, false))
+	})
+}
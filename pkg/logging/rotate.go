@@ -0,0 +1,102 @@
+package logging
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// RotatingFile is a log file that is renamed once it reaches its maximum
+// size, keeping a bounded number of the previous files as path.1, path.2...
+type RotatingFile struct {
+	path       string
+	maxSize    int64
+	maxBackups int
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+}
+
+// NewRotatingFile opens the file at path for appending.
+func NewRotatingFile(path string, maxSize int64, maxBackups int) (*RotatingFile, error) {
+	f := &RotatingFile{path: path, maxSize: maxSize, maxBackups: maxBackups}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *RotatingFile) open() error {
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	f.file, f.size = file, info.Size()
+	return nil
+}
+
+// Write appends p to the file, rotating it first if p would not fit. When the
+// rotation fails, p is still appended to the current file and the rotation
+// error is returned; the rotation is tried again on the next write.
+func (f *RotatingFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var rotateErr error
+	switch {
+	case f.file == nil:
+		// A failed rotation could not reopen the file either
+		if err := f.open(); err != nil {
+			return 0, err
+		}
+	case f.size > 0 && f.size+int64(len(p)) > f.maxSize:
+		if rotateErr = f.rotate(); f.file == nil {
+			return 0, rotateErr
+		}
+	}
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	if err == nil {
+		err = rotateErr
+	}
+	return n, err
+}
+
+// rotate shifts the backups by one, dropping the oldest, and starts a new file.
+// It reopens the current file when it cannot be renamed.
+func (f *RotatingFile) rotate() error {
+	err := f.file.Close()
+	f.file = nil
+	if err == nil {
+		for i := f.maxBackups - 1; i > 0; i-- {
+			// Missing backups are expected until the file has rotated often enough
+			os.Rename(backupPath(f.path, i), backupPath(f.path, i+1))
+		}
+		err = os.Rename(f.path, backupPath(f.path, 1))
+	}
+	if openErr := f.open(); openErr != nil {
+		return errors.Join(err, openErr)
+	}
+	return err
+}
+
+// Close closes the file.
+func (f *RotatingFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.file == nil {
+		return nil
+	}
+	return f.file.Close()
+}
+
+func backupPath(path string, i int) string {
+	return fmt.Sprintf("%s.%d", path, i)
+}
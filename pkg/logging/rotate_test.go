@@ -0,0 +1,79 @@
+package logging
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRotatingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "access.log")
+	file, err := NewRotatingFile(path, 10, 2)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	for _, line := range []string{"first\n", "second\n", "third\n", "fourth\n"} {
+		_, err := file.Write([]byte(line))
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, file.Close())
+
+	read := func(path string) string {
+		content, err := os.ReadFile(path)
+		assert.NoError(t, err)
+		return string(content)
+	}
+	assert.Equal(t, "fourth\n", read(path), "Expected the current file to hold the last line")
+	assert.Equal(t, "third\n", read(path+".1"))
+	assert.Equal(t, "second\n", read(path+".2"))
+	_, err = os.Stat(path + ".3")
+	assert.True(t, os.IsNotExist(err), "Expected only two backups to be kept")
+}
+
+func TestRotatingFileReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "access.log")
+	assert.NoError(t, os.WriteFile(path, []byte(strings.Repeat("x", 8)), 0o644))
+
+	// The size of the existing file counts toward the rotation
+	file, err := NewRotatingFile(path, 10, 1)
+	if !assert.NoError(t, err) {
+		return
+	}
+	_, err = file.Write([]byte("line\n"))
+	assert.NoError(t, err)
+	assert.NoError(t, file.Close())
+
+	content, _ := os.ReadFile(path)
+	assert.Equal(t, "line\n", string(content))
+}
+
+func TestRotatingFileRenameFailure(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "access.log")
+	// A non-empty directory in the way of the backup makes the rename fail
+	assert.NoError(t, os.MkdirAll(filepath.Join(path+".1", "blocker"), 0o755))
+
+	file, err := NewRotatingFile(path, 10, 1)
+	if !assert.NoError(t, err) {
+		return
+	}
+	_, err = file.Write([]byte("first\n"))
+	assert.NoError(t, err)
+	n, err := file.Write([]byte("second\n"))
+	assert.Error(t, err, "Expected the rotation failure to be reported")
+	assert.Equal(t, len("second\n"), n, "Expected the line to be written anyway")
+
+	// Once the way is clear, the next write rotates
+	assert.NoError(t, os.RemoveAll(path+".1"))
+	_, err = file.Write([]byte("third\n"))
+	assert.NoError(t, err)
+	assert.NoError(t, file.Close())
+
+	content, _ := os.ReadFile(path)
+	assert.Equal(t, "third\n", string(content))
+	content, _ = os.ReadFile(path + ".1")
+	assert.Equal(t, "first\nsecond\n", string(content))
+}
@@ -0,0 +1,291 @@
+// Package metrics implements the few Prometheus metric types the service
+// needs, and their text exposition format.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ContentType is the media type of the text exposition format.
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// DefaultBuckets are the upper bounds, in seconds, of the latency histograms.
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Collector is a metric family that can be exposed.
+type Collector interface {
+	Name() string
+	write(w *bufio.Writer)
+}
+
+// Registry holds the collectors exposed together.
+type Registry struct {
+	mu         sync.Mutex
+	collectors map[string]Collector
+}
+
+// NewRegistry returns an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{collectors: make(map[string]Collector)}
+}
+
+// Register adds collectors to the registry, replacing any collector registered under the same name.
+func (r *Registry) Register(collectors ...Collector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, c := range collectors {
+		r.collectors[c.Name()] = c
+	}
+}
+
+// WriteTo writes every registered metric in the text exposition format, sorted by name.
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.mu.Lock()
+	collectors := make([]Collector, 0, len(r.collectors))
+	for _, c := range r.collectors {
+		collectors = append(collectors, c)
+	}
+	r.mu.Unlock()
+	sort.Slice(collectors, func(i, j int) bool { return collectors[i].Name() < collectors[j].Name() })
+
+	counter := &countingWriter{w: w}
+	buffered := bufio.NewWriter(counter)
+	for _, c := range collectors {
+		c.write(buffered)
+	}
+	err := buffered.Flush()
+	return counter.n, err
+}
+
+// Sample is a single value of a metric family, reported by a collecting function.
+type Sample struct {
+	LabelValues []string
+	Value       float64
+}
+
+// CounterVec is a family of counters partitioned by labels.
+type CounterVec struct {
+	family
+	values map[string]*float64
+}
+
+// NewCounterVec returns a counter family with the given label names.
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	return &CounterVec{family: newFamily(name, help, "counter", labels), values: make(map[string]*float64)}
+}
+
+// Inc adds one to the counter with the given label values.
+func (c *CounterVec) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add adds v to the counter with the given label values.
+func (c *CounterVec) Add(v float64, labelValues ...string) {
+	key, ok := c.key(labelValues)
+	if !ok {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	value, ok := c.values[key]
+	if !ok {
+		value = new(float64)
+		c.values[key] = value
+	}
+	*value += v
+}
+
+func (c *CounterVec) write(w *bufio.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.header(w)
+	for _, key := range sortedKeys(c.values) {
+		c.sample(w, c.name, c.labelValues[key], "", *c.values[key])
+	}
+}
+
+// HistogramVec is a family of histograms partitioned by labels.
+type HistogramVec struct {
+	family
+	buckets []float64
+	values  map[string]*histogram
+}
+
+type histogram struct {
+	counts []uint64 // per bucket, not cumulative
+	sum    float64
+	count  uint64
+}
+
+// NewHistogramVec returns a histogram family with the given bucket upper bounds and label names.
+func NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	sorted := append([]float64(nil), buckets...)
+	sort.Float64s(sorted)
+	return &HistogramVec{
+		family:  newFamily(name, help, "histogram", labels),
+		buckets: sorted,
+		values:  make(map[string]*histogram),
+	}
+}
+
+// Observe records v in the histogram with the given label values.
+func (h *HistogramVec) Observe(v float64, labelValues ...string) {
+	key, ok := h.key(labelValues)
+	if !ok {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	value, ok := h.values[key]
+	if !ok {
+		value = &histogram{counts: make([]uint64, len(h.buckets))}
+		h.values[key] = value
+	}
+	if i := sort.SearchFloat64s(h.buckets, v); i < len(h.buckets) {
+		value.counts[i]++
+	}
+	value.sum += v
+	value.count++
+}
+
+func (h *HistogramVec) write(w *bufio.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.header(w)
+	for _, key := range sortedKeys(h.values) {
+		value, labelValues := h.values[key], h.labelValues[key]
+		var cumulative uint64
+		for i, bound := range h.buckets {
+			cumulative += value.counts[i]
+			h.sample(w, h.name+"_bucket", labelValues, formatFloat(bound), float64(cumulative))
+		}
+		h.sample(w, h.name+"_bucket", labelValues, "+Inf", float64(value.count))
+		h.sample(w, h.name+"_sum", labelValues, "", value.sum)
+		h.sample(w, h.name+"_count", labelValues, "", float64(value.count))
+	}
+}
+
+// Func is a metric family whose samples are collected when it is exposed,
+// for values kept elsewhere such as counters of another package.
+type Func struct {
+	family
+	collect func() []Sample
+}
+
+// NewGaugeFunc returns a gauge family collected by the given function.
+func NewGaugeFunc(name, help string, labels []string, collect func() []Sample) *Func {
+	return &Func{family: newFamily(name, help, "gauge", labels), collect: collect}
+}
+
+// NewCounterFunc returns a counter family collected by the given function.
+func NewCounterFunc(name, help string, labels []string, collect func() []Sample) *Func {
+	return &Func{family: newFamily(name, help, "counter", labels), collect: collect}
+}
+
+// write skips the samples with the wrong number of label values.
+func (f *Func) write(w *bufio.Writer) {
+	samples := f.collect()
+	f.header(w)
+	for _, s := range samples {
+		if len(s.LabelValues) == len(f.labels) {
+			f.sample(w, f.name, s.LabelValues, "", s.Value)
+		}
+	}
+}
+
+// family holds what all metric types share.
+type family struct {
+	name, help, kind string
+	labels           []string
+
+	mu          sync.Mutex
+	labelValues map[string][]string
+}
+
+func newFamily(name, help, kind string, labels []string) family {
+	return family{name: name, help: help, kind: kind, labels: labels, labelValues: make(map[string][]string)}
+}
+
+// Name returns the name of the metric family.
+func (f *family) Name() string {
+	return f.name
+}
+
+// key identifies a label combination, and remembers its values for the
+// exposition. It reports false for the wrong number of label values, whose
+// observation is dropped rather than failing the request that records it.
+func (f *family) key(labelValues []string) (string, bool) {
+	if len(labelValues) != len(f.labels) {
+		return "", false
+	}
+	key := strings.Join(labelValues, "\xff")
+	f.mu.Lock()
+	if _, ok := f.labelValues[key]; !ok {
+		f.labelValues[key] = append([]string(nil), labelValues...)
+	}
+	f.mu.Unlock()
+	return key, true
+}
+
+func (f *family) header(w *bufio.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n", f.name, strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(f.help))
+	fmt.Fprintf(w, "# TYPE %s %s\n", f.name, f.kind)
+}
+
+func (f *family) sample(w *bufio.Writer, name string, labelValues []string, le string, value float64) {
+	w.WriteString(name)
+	var pairs []string
+	for i, label := range f.labels {
+		pairs = append(pairs, label+`="`+escapeLabel(labelValues[i])+`"`)
+	}
+	if le != "" {
+		pairs = append(pairs, `le="`+le+`"`)
+	}
+	if len(pairs) > 0 {
+		w.WriteString("{" + strings.Join(pairs, ",") + "}")
+	}
+	w.WriteString(" " + formatFloat(value) + "\n")
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(value string) string {
+	return labelEscaper.Replace(value)
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
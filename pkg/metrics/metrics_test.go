@@ -0,0 +1,130 @@
+package metrics
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegistry(t *testing.T) {
+	requests := NewCounterVec("requests_total", "Requests served.", "route", "status")
+	requests.Inc("/company", "200")
+	requests.Inc("/company", "200")
+	requests.Add(3, `/odd"path`, "404")
+
+	duration := NewHistogramVec("duration_seconds", "Time spent.", []float64{0.1, 1}, "route")
+	duration.Observe(0.05, "/company")
+	duration.Observe(0.5, "/company")
+	duration.Observe(5, "/company")
+
+	queued := NewGaugeFunc("queued", "Queued lookups.", nil, func() []Sample {
+		return []Sample{{Value: 7}}
+	})
+
+	registry := NewRegistry()
+	registry.Register(requests, duration, queued)
+
+	var out strings.Builder
+	_, err := registry.WriteTo(&out)
+	assert.NoError(t, err)
+	assert.Equal(t, `# HELP duration_seconds Time spent.
+# TYPE duration_seconds histogram
+duration_seconds_bucket{route="/company",le="0.1"} 1
+duration_seconds_bucket{route="/company",le="1"} 2
+duration_seconds_bucket{route="/company",le="+Inf"} 3
+duration_seconds_sum{route="/company"} 5.55
+duration_seconds_count{route="/company"} 3
+# HELP queued Queued lookups.
+# TYPE queued gauge
+queued 7
+# HELP requests_total Requests served.
+# TYPE requests_total counter
+requests_total{route="/company",status="200"} 2
+requests_total{route="/odd\"path",status="404"} 3
+`, out.String())
+}
+
+func TestExpositionFormat(t *testing.T) {
+	requests := NewCounterVec("requests_total", "Requests served.\nBy route.", "route")
+	requests.Inc("/company")
+	requests.Add(2, "/odd\"path\\\n")
+
+	duration := NewHistogramVec("duration_seconds", "Time spent.", DefaultBuckets, "route")
+	duration.Observe(0.3, "/company")
+	duration.Observe(20, "/company")
+
+	queued := NewGaugeFunc("queued", "Queued lookups.", []string{"country"}, func() []Sample {
+		return []Sample{{LabelValues: []string{"us"}, Value: 7}, {LabelValues: []string{"ru"}, Value: math.Inf(1)}}
+	})
+
+	registry := NewRegistry()
+	registry.Register(requests, duration, queued)
+	var out strings.Builder
+	_, err := registry.WriteTo(&out)
+	assert.NoError(t, err)
+
+	var parser expfmt.TextParser
+	families, err := parser.TextToMetricFamilies(strings.NewReader(out.String()))
+	if !assert.NoError(t, err, "Expected the output to parse:\n%s", out.String()) {
+		return
+	}
+	assert.Len(t, families, 3)
+
+	counter := families["requests_total"]
+	assert.Equal(t, dto.MetricType_COUNTER, counter.GetType())
+	assert.Equal(t, "Requests served.\nBy route.", counter.GetHelp())
+	values := map[string]float64{}
+	for _, m := range counter.GetMetric() {
+		values[m.GetLabel()[0].GetValue()] = m.GetCounter().GetValue()
+	}
+	assert.Equal(t, map[string]float64{"/company": 1, "/odd\"path\\\n": 2}, values)
+
+	histogram := families["duration_seconds"].GetMetric()[0].GetHistogram()
+	assert.Equal(t, dto.MetricType_HISTOGRAM, families["duration_seconds"].GetType())
+	assert.Equal(t, uint64(2), histogram.GetSampleCount())
+	assert.Equal(t, 20.3, histogram.GetSampleSum())
+	assert.Len(t, histogram.GetBucket(), len(DefaultBuckets)+1, "Expected the buckets and +Inf")
+	for _, bucket := range histogram.GetBucket() {
+		expected := uint64(0)
+		for _, v := range []float64{0.3, 20} {
+			if v <= bucket.GetUpperBound() {
+				expected++
+			}
+		}
+		assert.Equal(t, expected, bucket.GetCumulativeCount(), "le=%v", bucket.GetUpperBound())
+	}
+
+	gauge := families["queued"]
+	assert.Equal(t, dto.MetricType_GAUGE, gauge.GetType())
+	assert.Len(t, gauge.GetMetric(), 2)
+}
+
+func TestLabelCount(t *testing.T) {
+	requests := NewCounterVec("requests_total", "Requests served.", "route")
+	duration := NewHistogramVec("duration_seconds", "Time spent.", DefaultBuckets, "route")
+	queued := NewGaugeFunc("queued", "Queued lookups.", []string{"country"}, func() []Sample {
+		return []Sample{{Value: 7}}
+	})
+
+	// Observations with the wrong number of label values are dropped
+	assert.NotPanics(t, func() {
+		requests.Inc("/company", "200")
+		duration.Observe(1)
+	})
+
+	registry := NewRegistry()
+	registry.Register(requests, duration, queued)
+	var out strings.Builder
+	assert.NotPanics(t, func() { registry.WriteTo(&out) })
+	assert.Equal(t, `# HELP duration_seconds Time spent.
+# TYPE duration_seconds histogram
+# HELP queued Queued lookups.
+# TYPE queued gauge
+# HELP requests_total Requests served.
+# TYPE requests_total counter
+`, out.String())
+}
@@ -1,8 +1,51 @@
 package models
 
+import "time"
+
 type Company struct {
 	ID          string `json:"id"`
 	Name        string `json:"name"`
 	Active      bool   `json:"active"`
 	ActiveUntil string `json:"active_until,omitempty"`
+
+	// The fields below are only exposed by the detailed representation, so
+	// that the original response shape stays unchanged.
+	IncorporatedOn string    `json:"-"`
+	TaxID          string    `json:"-"`
+	Country        string    `json:"-"`
+	Format         string    `json:"-"`
+	FetchedAt      time.Time `json:"-"`
+
+	// Stale is set when the company was served from an expired cache entry
+	// because its backend could not be reached.
+	Stale bool `json:"-"`
+}
+
+// CompanyDetails is the detailed representation of a company, with every
+// field known from its backend.
+type CompanyDetails struct {
+	ID             string    `json:"id"`
+	Name           string    `json:"name"`
+	Active         bool      `json:"active"`
+	ActiveUntil    string    `json:"active_until,omitempty"`
+	IncorporatedOn string    `json:"incorporated_on,omitempty"`
+	TaxID          string    `json:"tax_id,omitempty"`
+	Country        string    `json:"country,omitempty"`
+	Format         string    `json:"source_format,omitempty"`
+	FetchedAt      time.Time `json:"fetched_at"`
+}
+
+// Details returns the detailed representation of the company.
+func (c *Company) Details() CompanyDetails {
+	return CompanyDetails{
+		ID:             c.ID,
+		Name:           c.Name,
+		Active:         c.Active,
+		ActiveUntil:    c.ActiveUntil,
+		IncorporatedOn: c.IncorporatedOn,
+		TaxID:          c.TaxID,
+		Country:        c.Country,
+		Format:         c.Format,
+		FetchedAt:      c.FetchedAt,
+	}
 }
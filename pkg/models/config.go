@@ -1,6 +1,9 @@
 package models
 
-import "time"
+import (
+	"math"
+	"time"
+)
 
 type ServerConfig struct {
 	Port               int           `yaml:"Port"`
@@ -13,19 +16,427 @@ type ServerConfig struct {
 }
 
 type ApplicationConfig struct {
-	MockFlag  bool `yaml:"MockFlag"`
-	DebugMode bool `yaml:"DebugMode"`
-	CacheSize int  `yaml:"CacheSize"`
-	Workers   int  `yaml:"Workers"`
+	MockFlag     bool            `yaml:"MockFlag"`
+	DebugMode    bool            `yaml:"DebugMode"`
+	CacheSize    int             `yaml:"CacheSize"`
+	Workers      int             `yaml:"Workers"`
+	QueueDepth   int             `yaml:"QueueDepth"`
+	MaxQueueWait time.Duration   `yaml:"MaxQueueWait"`
+	Autoscale    AutoscaleConfig `yaml:"Autoscale"`
+	Batch        BatchConfig     `yaml:"Batch"`
+}
+
+// BatchConfig bounds the batch lookups.
+type BatchConfig struct {
+	// MaxItems is the largest number of lookups in a single batch
+	MaxItems int `yaml:"MaxItems"`
+	// Concurrency is the number of lookups of a batch in flight at once
+	Concurrency int `yaml:"Concurrency"`
+	// StreamWriteTimeout replaces the server write timeout for the whole
+	// response of a stream, which is written as its lookups complete
+	StreamWriteTimeout time.Duration `yaml:"StreamWriteTimeout"`
+}
+
+// WithDefaults returns b with its unset settings replaced by defaults.
+func (b BatchConfig) WithDefaults() BatchConfig {
+	if b.MaxItems <= 0 {
+		b.MaxItems = 10000
+	}
+	if b.Concurrency <= 0 {
+		b.Concurrency = 10
+	}
+	if b.StreamWriteTimeout <= 0 {
+		b.StreamWriteTimeout = 10 * time.Minute
+	}
+	return b
+}
+
+// AutoscaleConfig bounds the worker pool when it is resized with the load,
+// instead of keeping Application.Workers workers.
+type AutoscaleConfig struct {
+	Enabled    bool `yaml:"Enabled"`
+	MinWorkers int  `yaml:"MinWorkers"`
+	MaxWorkers int  `yaml:"MaxWorkers"`
+	// Interval is how often the pool size is reconsidered
+	Interval time.Duration `yaml:"Interval"`
+	// TargetQueueWait is the average queue wait above which the pool grows
+	TargetQueueWait time.Duration `yaml:"TargetQueueWait"`
+}
+
+// WithDefaults returns a with its unset settings replaced by defaults, using
+// the fixed pool size as the upper bound.
+func (a AutoscaleConfig) WithDefaults(workers int) AutoscaleConfig {
+	if a.MinWorkers <= 0 {
+		a.MinWorkers = 1
+	}
+	if a.MaxWorkers <= 0 {
+		a.MaxWorkers = workers
+	}
+	if a.MaxWorkers < a.MinWorkers {
+		a.MaxWorkers = a.MinWorkers
+	}
+	a.Interval = firstPositive(a.Interval, time.Second)
+	a.TargetQueueWait = firstPositive(a.TargetQueueWait, 10*time.Millisecond)
+	return a
 }
 
 type LimiterConfig struct {
-	Limit  int    `yaml:"Limit"`
-	Period string `yaml:"Period"`
+	Limit             int    `yaml:"Limit"`
+	Period            string `yaml:"Period"`
+	PerIPLimit        int    `yaml:"PerIPLimit"`
+	PerAPIKeyLimit    int    `yaml:"PerAPIKeyLimit"`
+	APIKeyHeader      string `yaml:"APIKeyHeader"`
+	MaxTrackedClients int    `yaml:"MaxTrackedClients"`
+}
+
+// Defaults used when a setting is configured neither for a country nor globally.
+const (
+	DefaultRequestTimeout = 5 * time.Second
+	DefaultCacheTTL       = time.Minute
+	DefaultNotFoundTTL    = 10 * time.Second
+	DefaultMaxStale       = 10 * time.Minute
+)
+
+// DefaultBreaker is the circuit breaker configuration used for the settings left unset.
+var DefaultBreaker = BreakerConfig{
+	FailureThreshold: 5,
+	CoolDown:         10 * time.Second,
+	HalfOpenRequests: 1,
+}
+
+// Load-balancing strategies across the replicas of a country backend.
+const (
+	BalancerRoundRobin       = "round-robin"
+	BalancerLeastOutstanding = "least-outstanding"
+	BalancerWeighted         = "weighted"
+)
+
+// DefaultLoadBalancing is the load-balancing configuration used for the settings left unset.
+var DefaultLoadBalancing = LoadBalancingConfig{
+	Strategy:   BalancerRoundRobin,
+	EjectAfter: 3,
+	EjectFor:   30 * time.Second,
+}
+
+// defaultJitter is the jitter of DefaultRetry.
+var defaultJitter = 0.2
+
+// DefaultRetry is the retry policy used for the settings left unset.
+var DefaultRetry = RetryConfig{
+	MaxAttempts:       1,
+	InitialBackoff:    50 * time.Millisecond,
+	MaxBackoff:        time.Second,
+	Jitter:            &defaultJitter,
+	RetryableStatuses: []int{502, 503, 504},
+}
+
+// Cache modes of the backend client.
+const (
+	// CacheModeStandard serves cached companies until their TTL runs out.
+	CacheModeStandard = "standard"
+	// CacheModeStaleWhileRevalidate refreshes companies in the background once
+	// they pass their soft TTL, and serves expired companies when a backend fails.
+	CacheModeStaleWhileRevalidate = "stale-while-revalidate"
+)
+
+// UpstreamConfig holds the settings used when talking to the country backends.
+type UpstreamConfig struct {
+	RequestTimeout time.Duration                    `yaml:"RequestTimeout"`
+	ReadTimeout    time.Duration                    `yaml:"ReadTimeout"`
+	WriteTimeout   time.Duration                    `yaml:"WriteTimeout"`
+	CacheTTL       time.Duration                    `yaml:"CacheTTL"`
+	NotFoundTTL    time.Duration                    `yaml:"NotFoundTTL"`
+	CacheMode      string                           `yaml:"CacheMode"`
+	SoftTTL        time.Duration                    `yaml:"SoftTTL"`
+	MaxStale       time.Duration                    `yaml:"MaxStale"`
+	Retry          RetryConfig                      `yaml:"Retry"`
+	Breaker        BreakerConfig                    `yaml:"Breaker"`
+	Hedging        HedgingConfig                    `yaml:"Hedging"`
+	LoadBalancing  LoadBalancingConfig              `yaml:"LoadBalancing"`
+	HealthCheck    HealthCheckConfig                `yaml:"HealthCheck"`
+	Mappings       []ResponseMapping                `yaml:"Mappings"`
+	Countries      map[string]CountryUpstreamConfig `yaml:"Countries"`
+}
+
+// ResponseMapping declares how to decode the backend responses of a media
+// type, so that new vendor schemas need no code change.
+type ResponseMapping struct {
+	// MediaType may carry a version parameter, as in "application/x-company; version=3"
+	MediaType string `yaml:"MediaType"`
+	// NamePath is the dot-separated JSON path of the company name, as in "data.legal_name"
+	NamePath string `yaml:"NamePath"`
+	// DissolvedOnPath is the JSON path of the dissolution date, absent while the company is active
+	DissolvedOnPath string `yaml:"DissolvedOnPath"`
+	// DateLayout is the Go time layout of the dates, RFC 3339 by default
+	DateLayout string `yaml:"DateLayout"`
+	// IncorporatedOnPath and TaxIDPath optionally locate the details of the company
+	IncorporatedOnPath string `yaml:"IncorporatedOnPath"`
+	TaxIDPath          string `yaml:"TaxIDPath"`
+}
+
+// CountryUpstreamConfig overrides the upstream settings for a single country backend.
+type CountryUpstreamConfig struct {
+	RequestTimeout time.Duration       `yaml:"RequestTimeout"`
+	CacheTTL       time.Duration       `yaml:"CacheTTL"`
+	NotFoundTTL    time.Duration       `yaml:"NotFoundTTL"`
+	SoftTTL        time.Duration       `yaml:"SoftTTL"`
+	MaxStale       time.Duration       `yaml:"MaxStale"`
+	Retry          RetryConfig         `yaml:"Retry"`
+	Breaker        BreakerConfig       `yaml:"Breaker"`
+	LoadBalancing  LoadBalancingConfig `yaml:"LoadBalancing"`
+}
+
+// RetryConfig is the policy for retrying transient failures of a backend.
+type RetryConfig struct {
+	MaxAttempts    int           `yaml:"MaxAttempts"`
+	InitialBackoff time.Duration `yaml:"InitialBackoff"`
+	MaxBackoff     time.Duration `yaml:"MaxBackoff"`
+	// Jitter is a pointer so that 0, which turns the jitter off, can be told from unset
+	Jitter            *float64 `yaml:"Jitter"`
+	RetryableStatuses []int    `yaml:"RetryableStatuses"`
+}
+
+// merge returns r with its unset settings taken from fallback.
+func (r RetryConfig) merge(fallback RetryConfig) RetryConfig {
+	if r.MaxAttempts <= 0 {
+		r.MaxAttempts = fallback.MaxAttempts
+	}
+	r.InitialBackoff = firstPositive(r.InitialBackoff, fallback.InitialBackoff)
+	r.MaxBackoff = firstPositive(r.MaxBackoff, fallback.MaxBackoff)
+	if r.Jitter == nil || *r.Jitter < 0 {
+		r.Jitter = fallback.Jitter
+	}
+	if len(r.RetryableStatuses) == 0 {
+		r.RetryableStatuses = fallback.RetryableStatuses
+	}
+	return r
+}
+
+// BreakerConfig configures the circuit breaker of a backend.
+type BreakerConfig struct {
+	FailureThreshold int           `yaml:"FailureThreshold"`
+	CoolDown         time.Duration `yaml:"CoolDown"`
+	HalfOpenRequests int           `yaml:"HalfOpenRequests"`
+}
+
+// merge returns b with its unset settings taken from fallback.
+func (b BreakerConfig) merge(fallback BreakerConfig) BreakerConfig {
+	if b.FailureThreshold <= 0 {
+		b.FailureThreshold = fallback.FailureThreshold
+	}
+	b.CoolDown = firstPositive(b.CoolDown, fallback.CoolDown)
+	if b.HalfOpenRequests <= 0 {
+		b.HalfOpenRequests = fallback.HalfOpenRequests
+	}
+	return b
+}
+
+// LoadBalancingConfig configures how requests are spread over the replicas of a
+// country backend, and when a failing replica is taken out of rotation.
+type LoadBalancingConfig struct {
+	Strategy   string        `yaml:"Strategy"`
+	EjectAfter int           `yaml:"EjectAfter"`
+	EjectFor   time.Duration `yaml:"EjectFor"`
+}
+
+// merge returns l with its unset settings taken from fallback.
+func (l LoadBalancingConfig) merge(fallback LoadBalancingConfig) LoadBalancingConfig {
+	if l.Strategy == "" {
+		l.Strategy = fallback.Strategy
+	}
+	if l.EjectAfter <= 0 {
+		l.EjectAfter = fallback.EjectAfter
+	}
+	l.EjectFor = firstPositive(l.EjectFor, fallback.EjectFor)
+	return l
+}
+
+// HealthCheckConfig configures the active health checks of the backend replicas.
+type HealthCheckConfig struct {
+	Enabled        bool          `yaml:"Enabled"`
+	Path           string        `yaml:"Path"`
+	Interval       time.Duration `yaml:"Interval"`
+	Timeout        time.Duration `yaml:"Timeout"`
+	ExpectedStatus int           `yaml:"ExpectedStatus"`
+	// RequireHealthy makes the service report itself not ready while a country has no healthy replica
+	RequireHealthy bool `yaml:"RequireHealthy"`
+}
+
+// WithDefaults returns h with its unset settings replaced by defaults.
+func (h HealthCheckConfig) WithDefaults() HealthCheckConfig {
+	if h.Path == "" {
+		h.Path = "/"
+	}
+	h.Interval = firstPositive(h.Interval, 10*time.Second)
+	h.Timeout = firstPositive(h.Timeout, time.Second)
+	if h.ExpectedStatus == 0 {
+		h.ExpectedStatus = 200
+	}
+	return h
+}
+
+// HedgingConfig configures hedged requests, sent when a backend is slower
+// than usual to answer.
+type HedgingConfig struct {
+	Enabled bool `yaml:"Enabled"`
+	// Percentile of the recent backend latency after which a request is hedged
+	Percentile float64 `yaml:"Percentile"`
+	// MinDelay is the shortest time to wait before hedging
+	MinDelay time.Duration `yaml:"MinDelay"`
+	// MaxRatio caps the share of requests that may be hedged
+	MaxRatio float64 `yaml:"MaxRatio"`
+	// Window is the number of recent latencies the percentile is computed over
+	Window int `yaml:"Window"`
+}
+
+// WithDefaults returns h with its unset settings replaced by defaults.
+func (h HedgingConfig) WithDefaults() HedgingConfig {
+	if h.Percentile <= 0 || h.Percentile > 100 {
+		h.Percentile = 95
+	}
+	if h.MaxRatio <= 0 {
+		h.MaxRatio = 0.1
+	}
+	if h.Window <= 0 {
+		h.Window = 100
+	}
+	return h
+}
+
+// For returns the effective settings for the given country backend, with the
+// country overrides applied over the global settings and the defaults.
+func (u UpstreamConfig) For(country string) CountryUpstreamConfig {
+	c := u.Countries[country]
+	cacheTTL := firstPositive(c.CacheTTL, u.CacheTTL, DefaultCacheTTL)
+	return CountryUpstreamConfig{
+		RequestTimeout: firstPositive(c.RequestTimeout, u.RequestTimeout, DefaultRequestTimeout),
+		CacheTTL:       cacheTTL,
+		NotFoundTTL:    firstPositive(c.NotFoundTTL, u.NotFoundTTL, DefaultNotFoundTTL),
+		SoftTTL:        firstPositive(c.SoftTTL, u.SoftTTL, cacheTTL/2),
+		MaxStale:       firstPositive(c.MaxStale, u.MaxStale, DefaultMaxStale),
+		Retry:          c.Retry.merge(u.Retry.merge(DefaultRetry)),
+		Breaker:        c.Breaker.merge(u.Breaker.merge(DefaultBreaker)),
+		LoadBalancing:  c.LoadBalancing.merge(u.LoadBalancing.merge(DefaultLoadBalancing)),
+	}
+}
+
+// firstPositive returns the first of the given durations that is set.
+func firstPositive(durations ...time.Duration) time.Duration {
+	for _, d := range durations {
+		if d > 0 {
+			return d
+		}
+	}
+	return 0
+}
+
+// TracingConfig configures the tracing of the requests and their upstream calls.
+type TracingConfig struct {
+	Enabled bool `yaml:"Enabled"`
+	// Exporter is either "file" or "otlp"
+	Exporter string `yaml:"Exporter"`
+	// FilePath is the file the "file" exporter appends spans to
+	FilePath string `yaml:"FilePath"`
+	// Endpoint is the OTLP/HTTP traces endpoint of the collector
+	Endpoint    string `yaml:"Endpoint"`
+	ServiceName string `yaml:"ServiceName"`
+	// SampleRatio is the share of new traces exported, incoming traces keep the
+	// decision of their caller. It is a pointer so that 0, which exports none of
+	// them, can be told from unset
+	SampleRatio *float64 `yaml:"SampleRatio"`
+}
+
+// WithDefaults returns t with its unset settings replaced by defaults.
+func (t TracingConfig) WithDefaults() TracingConfig {
+	if t.Exporter == "" {
+		t.Exporter = "otlp"
+	}
+	if t.FilePath == "" {
+		t.FilePath = "spans.jsonl"
+	}
+	if t.Endpoint == "" {
+		t.Endpoint = "http://localhost:4318/v1/traces"
+	}
+	if t.ServiceName == "" {
+		t.ServiceName = "backendify"
+	}
+	t.SampleRatio = sampleRatio(t.SampleRatio)
+	return t
+}
+
+// sampleRatio returns ratio within [0, 1], or 1 when it is unset.
+func sampleRatio(ratio *float64) *float64 {
+	resolved := 1.0
+	if ratio != nil && *ratio >= 0 {
+		resolved = math.Min(*ratio, 1)
+	}
+	return &resolved
+}
+
+// LoggingConfig configures the application and access logs.
+type LoggingConfig struct {
+	// Level is the lowest level logged, lowered to "debug" in debug mode
+	Level string `yaml:"Level"`
+	// Format is either "logfmt" or "json"
+	Format string          `yaml:"Format"`
+	Access AccessLogConfig `yaml:"Access"`
+}
+
+// WithDefaults returns l with its unset settings replaced by defaults.
+func (l LoggingConfig) WithDefaults() LoggingConfig {
+	if l.Level == "" {
+		l.Level = "info"
+	}
+	if l.Format == "" {
+		l.Format = "logfmt"
+	}
+	l.Access = l.Access.WithDefaults()
+	return l
+}
+
+// AccessLogConfig configures the line logged for every request served.
+type AccessLogConfig struct {
+	// Level is the level of the lines of successful requests, failed ones are
+	// logged as warnings (4xx) or errors (5xx)
+	Level string `yaml:"Level"`
+	// Fields are the fields of a line, out of method, path, uri, status,
+	// bytes, duration, country, id, cache_hit, upstream_latency, request_id
+	// and remote_addr
+	Fields []string `yaml:"Fields"`
+	// SampleRatio is the share of successful requests logged, failed ones are
+	// always logged. It is a pointer so that 0, which logs none, can be told from unset
+	SampleRatio *float64 `yaml:"SampleRatio"`
+	// FilePath is the file access lines go to, instead of the application log
+	FilePath string `yaml:"FilePath"`
+	// MaxSizeMB is the size at which the file is rotated
+	MaxSizeMB int `yaml:"MaxSizeMB"`
+	// MaxBackups is the number of rotated files kept
+	MaxBackups int `yaml:"MaxBackups"`
+}
+
+// WithDefaults returns a with its unset settings replaced by defaults.
+func (a AccessLogConfig) WithDefaults() AccessLogConfig {
+	if a.Level == "" {
+		a.Level = "info"
+	}
+	if len(a.Fields) == 0 {
+		a.Fields = []string{"method", "path", "status", "bytes", "duration", "country", "cache_hit", "upstream_latency", "request_id"}
+	}
+	a.SampleRatio = sampleRatio(a.SampleRatio)
+	if a.MaxSizeMB <= 0 {
+		a.MaxSizeMB = 100
+	}
+	if a.MaxBackups <= 0 {
+		a.MaxBackups = 5
+	}
+	return a
 }
 
 type Config struct {
 	Server      ServerConfig      `yaml:"Server"`
 	Application ApplicationConfig `yaml:"Application"`
 	Limiter     LimiterConfig     `yaml:"Limiter"`
+	Upstream    UpstreamConfig    `yaml:"Upstream"`
+	Tracing     TracingConfig     `yaml:"Tracing"`
+	Logging     LoggingConfig     `yaml:"Logging"`
 }
@@ -0,0 +1,171 @@
+package tracing
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+// Exporter sends finished spans somewhere they can be looked at.
+type Exporter interface {
+	Export(spans []SpanData) error
+	Close() error
+}
+
+// FileExporter appends spans to a file, one JSON object per line.
+type FileExporter struct {
+	mu      sync.Mutex
+	file    *os.File
+	encoder *json.Encoder
+}
+
+// NewFileExporter opens the file spans are appended to.
+func NewFileExporter(path string) (*FileExporter, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return &FileExporter{file: file, encoder: json.NewEncoder(file)}, nil
+}
+
+func (e *FileExporter) Export(spans []SpanData) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, span := range spans {
+		if err := e.encoder.Encode(span); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *FileExporter) Close() error {
+	return e.file.Close()
+}
+
+// OTLPExporter posts spans to an OpenTelemetry collector with OTLP over
+// HTTP, in its JSON encoding.
+type OTLPExporter struct {
+	endpoint    string
+	serviceName string
+	client      *fasthttp.Client
+}
+
+// NewOTLPExporter returns an exporter posting to the traces endpoint of a
+// collector, such as http://localhost:4318/v1/traces.
+func NewOTLPExporter(endpoint, serviceName string) *OTLPExporter {
+	return &OTLPExporter{endpoint: endpoint, serviceName: serviceName, client: &fasthttp.Client{}}
+}
+
+const exportTimeout = 5 * time.Second
+
+func (e *OTLPExporter) Export(spans []SpanData) error {
+	body, err := json.Marshal(e.request(spans))
+	if err != nil {
+		return err
+	}
+
+	req := fasthttp.AcquireRequest()
+	resp := fasthttp.AcquireResponse()
+	defer fasthttp.ReleaseRequest(req)
+	defer fasthttp.ReleaseResponse(resp)
+
+	req.SetRequestURI(e.endpoint)
+	req.Header.SetMethod(fasthttp.MethodPost)
+	req.Header.SetContentType("application/json")
+	req.SetBody(body)
+	if err := e.client.DoTimeout(req, resp, exportTimeout); err != nil {
+		return err
+	}
+	if status := resp.StatusCode(); status < 200 || status > 299 {
+		return fmt.Errorf("collector answered with status %d", status)
+	}
+	return nil
+}
+
+func (e *OTLPExporter) Close() error {
+	return nil
+}
+
+// OTLP/JSON encoding of the spans, see opentelemetry-proto.
+type (
+	otlpRequest struct {
+		ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+	}
+	otlpResourceSpans struct {
+		Resource   otlpResource     `json:"resource"`
+		ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+	}
+	otlpResource struct {
+		Attributes []otlpAttribute `json:"attributes"`
+	}
+	otlpScopeSpans struct {
+		Scope otlpScope  `json:"scope"`
+		Spans []otlpSpan `json:"spans"`
+	}
+	otlpScope struct {
+		Name string `json:"name"`
+	}
+	otlpSpan struct {
+		TraceID           string          `json:"traceId"`
+		SpanID            string          `json:"spanId"`
+		ParentSpanID      string          `json:"parentSpanId,omitempty"`
+		Name              string          `json:"name"`
+		Kind              int             `json:"kind"`
+		StartTimeUnixNano string          `json:"startTimeUnixNano"`
+		EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+		Attributes        []otlpAttribute `json:"attributes,omitempty"`
+		Status            otlpStatus      `json:"status"`
+	}
+	otlpAttribute struct {
+		Key   string    `json:"key"`
+		Value otlpValue `json:"value"`
+	}
+	otlpValue struct {
+		StringValue string `json:"stringValue"`
+	}
+	otlpStatus struct {
+		Code    int    `json:"code"`
+		Message string `json:"message,omitempty"`
+	}
+)
+
+const (
+	otlpStatusOK    = 1
+	otlpStatusError = 2
+)
+
+func (e *OTLPExporter) request(spans []SpanData) otlpRequest {
+	converted := make([]otlpSpan, 0, len(spans))
+	for _, span := range spans {
+		s := otlpSpan{
+			TraceID:           span.TraceID,
+			SpanID:            span.SpanID,
+			ParentSpanID:      span.ParentSpanID,
+			Name:              span.Name,
+			Kind:              int(span.Kind),
+			StartTimeUnixNano: strconv.FormatInt(span.Start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(span.End.UnixNano(), 10),
+			Status:            otlpStatus{Code: otlpStatusOK},
+		}
+		for key, value := range span.Attributes {
+			s.Attributes = append(s.Attributes, otlpAttribute{Key: key, Value: otlpValue{StringValue: value}})
+		}
+		if span.Error != "" {
+			s.Status = otlpStatus{Code: otlpStatusError, Message: span.Error}
+		}
+		converted = append(converted, s)
+	}
+
+	return otlpRequest{ResourceSpans: []otlpResourceSpans{{
+		Resource: otlpResource{Attributes: []otlpAttribute{
+			{Key: "service.name", Value: otlpValue{StringValue: e.serviceName}},
+		}},
+		ScopeSpans: []otlpScopeSpans{{Scope: otlpScope{Name: "backendify"}, Spans: converted}},
+	}}}
+}
@@ -0,0 +1,415 @@
+// Package tracing records spans of the stages of a request, propagates
+// them with the W3C traceparent header and exports them in batches.
+package tracing
+
+import (
+	"backendify/pkg/models"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Exporter names.
+const (
+	ExporterFile = "file"
+	ExporterOTLP = "otlp"
+)
+
+// TraceparentHeader is the W3C header carrying the span context.
+const TraceparentHeader = "traceparent"
+
+var ErrUnknownExporter = errors.New("unknown trace exporter")
+
+type (
+	TraceID [16]byte
+	SpanID  [8]byte
+)
+
+func (t TraceID) String() string { return hex.EncodeToString(t[:]) }
+func (s SpanID) String() string  { return hex.EncodeToString(s[:]) }
+
+// SpanContext identifies a span across process boundaries.
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+	Sampled bool
+}
+
+// Valid reports whether the span context identifies a span.
+func (sc SpanContext) Valid() bool {
+	return sc.TraceID != TraceID{} && sc.SpanID != SpanID{}
+}
+
+// Traceparent formats the span context as a traceparent header value.
+func (sc SpanContext) Traceparent() string {
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+	return "00-" + sc.TraceID.String() + "-" + sc.SpanID.String() + "-" + flags
+}
+
+// ParseTraceparent parses a traceparent header value.
+func ParseTraceparent(value string) (SpanContext, bool) {
+	parts := strings.Split(strings.TrimSpace(value), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" || (parts[0] == "00" && len(parts) != 4) {
+		return SpanContext{}, false
+	}
+
+	var sc SpanContext
+	var flags [1]byte
+	if !decodeHex(sc.TraceID[:], parts[1]) || !decodeHex(sc.SpanID[:], parts[2]) || !decodeHex(flags[:], parts[3]) {
+		return SpanContext{}, false
+	}
+	sc.Sampled = flags[0]&1 == 1
+	return sc, sc.Valid()
+}
+
+func decodeHex(dst []byte, s string) bool {
+	if len(s) != 2*len(dst) || strings.ToLower(s) != s {
+		return false
+	}
+	_, err := hex.Decode(dst, []byte(s))
+	return err == nil
+}
+
+// SpanKind tells how a span relates to the other services of a trace, which
+// lets a collector link the spans of a caller and a callee.
+type SpanKind int
+
+// Span kinds, numbered as in the OTLP protocol.
+const (
+	// SpanKindInternal is a stage within the service
+	SpanKindInternal SpanKind = iota + 1
+	// SpanKindServer is a request served to another service
+	SpanKindServer
+	// SpanKindClient is a request made to another service
+	SpanKindClient
+)
+
+func (k SpanKind) String() string {
+	switch k {
+	case SpanKindServer:
+		return "server"
+	case SpanKindClient:
+		return "client"
+	}
+	return "internal"
+}
+
+func (k SpanKind) MarshalText() ([]byte, error) {
+	return []byte(k.String()), nil
+}
+
+func (k *SpanKind) UnmarshalText(text []byte) error {
+	switch string(text) {
+	case "server":
+		*k = SpanKindServer
+	case "client":
+		*k = SpanKindClient
+	default:
+		*k = SpanKindInternal
+	}
+	return nil
+}
+
+// SpanData is a finished span, as handed to the exporters.
+type SpanData struct {
+	TraceID      string            `json:"trace_id"`
+	SpanID       string            `json:"span_id"`
+	ParentSpanID string            `json:"parent_span_id,omitempty"`
+	Name         string            `json:"name"`
+	Kind         SpanKind          `json:"kind"`
+	Start        time.Time         `json:"start"`
+	End          time.Time         `json:"end"`
+	Attributes   map[string]string `json:"attributes,omitempty"`
+	Error        string            `json:"error,omitempty"`
+}
+
+// Span is a stage of a request. All methods are no-ops on a nil span, which
+// is what Start returns while tracing is disabled.
+type Span struct {
+	tracer  *Tracer
+	context SpanContext
+	parent  SpanID
+	name    string
+	kind    SpanKind
+	start   time.Time
+
+	mu         sync.Mutex
+	attributes map[string]string
+	err        string
+	ended      bool
+}
+
+// Context returns the span context, to propagate to a downstream service.
+func (s *Span) Context() SpanContext {
+	if s == nil {
+		return SpanContext{}
+	}
+	return s.context
+}
+
+// SetAttribute annotates the span.
+func (s *Span) SetAttribute(key, value string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ended {
+		return
+	}
+	if s.attributes == nil {
+		s.attributes = make(map[string]string)
+	}
+	s.attributes[key] = value
+}
+
+// SetError marks the span as failed.
+func (s *Span) SetError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.err = err.Error()
+}
+
+// End finishes the span and queues it for export. Only the first call counts.
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	data := SpanData{
+		TraceID:    s.context.TraceID.String(),
+		SpanID:     s.context.SpanID.String(),
+		Name:       s.name,
+		Kind:       s.kind,
+		Start:      s.start,
+		End:        time.Now(),
+		Attributes: s.attributes,
+		Error:      s.err,
+	}
+	s.mu.Unlock()
+
+	if s.parent != (SpanID{}) {
+		data.ParentSpanID = s.parent.String()
+	}
+	if s.context.Sampled {
+		s.tracer.enqueue(data)
+	}
+}
+
+// Tracer creates spans and exports the finished ones in batches.
+type Tracer struct {
+	exporter    Exporter
+	sampleRatio float64
+	logger      *logrus.Logger
+
+	spans   chan SpanData
+	dropped atomic.Int64
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+const (
+	batchSize     = 100
+	batchInterval = time.Second
+	queueSize     = 4096
+)
+
+// NewTracer returns the tracer described by the configuration, or nil when
+// tracing is disabled.
+func NewTracer(config models.TracingConfig, logger *logrus.Logger) (*Tracer, error) {
+	if !config.Enabled {
+		return nil, nil
+	}
+	config = config.WithDefaults()
+
+	var exporter Exporter
+	var err error
+	switch config.Exporter {
+	case ExporterFile:
+		exporter, err = NewFileExporter(config.FilePath)
+	case ExporterOTLP:
+		exporter = NewOTLPExporter(config.Endpoint, config.ServiceName)
+	default:
+		err = fmt.Errorf("%w: %q", ErrUnknownExporter, config.Exporter)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return newTracer(exporter, *config.SampleRatio, logger), nil
+}
+
+func newTracer(exporter Exporter, sampleRatio float64, logger *logrus.Logger) *Tracer {
+	t := &Tracer{
+		exporter:    exporter,
+		sampleRatio: sampleRatio,
+		logger:      logger,
+		spans:       make(chan SpanData, queueSize),
+		stop:        make(chan struct{}),
+		done:        make(chan struct{}),
+	}
+	go t.run()
+	return t
+}
+
+// enqueue hands a finished span to the exporting goroutine, dropping it
+// rather than blocking the request when the exporter falls behind.
+func (t *Tracer) enqueue(data SpanData) {
+	select {
+	case <-t.stop:
+		t.dropped.Add(1)
+	case t.spans <- data:
+	default:
+		t.dropped.Add(1)
+	}
+}
+
+func (t *Tracer) run() {
+	defer close(t.done)
+
+	ticker := time.NewTicker(batchInterval)
+	defer ticker.Stop()
+
+	batch := make([]SpanData, 0, batchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := t.exporter.Export(batch); err != nil && t.logger != nil {
+			t.logger.Warn("Exporting spans failed: ", err)
+		}
+		batch = make([]SpanData, 0, batchSize)
+	}
+
+	for {
+		select {
+		case data := <-t.spans:
+			batch = append(batch, data)
+			if len(batch) == batchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		case <-t.stop:
+			// Export what is left, spans ended from now on are dropped
+			for {
+				select {
+				case data := <-t.spans:
+					batch = append(batch, data)
+					if len(batch) == batchSize {
+						flush()
+					}
+				default:
+					flush()
+					return
+				}
+			}
+		}
+	}
+}
+
+// Shutdown exports the spans still queued and closes the exporter.
+func (t *Tracer) Shutdown() error {
+	if t == nil {
+		return nil
+	}
+	close(t.stop)
+	<-t.done
+	return t.exporter.Close()
+}
+
+// sample decides whether a new trace is exported.
+func (t *Tracer) sample(traceID TraceID) bool {
+	if t.sampleRatio >= 1 {
+		return true
+	}
+	// The trace ID is random, so its low bits are a uniform draw
+	var bits uint64
+	for _, b := range traceID[8:] {
+		bits = bits<<8 | uint64(b)
+	}
+	return float64(bits>>11)/float64(1<<53) < t.sampleRatio
+}
+
+var defaultTracer atomic.Pointer[Tracer]
+
+// SetTracer sets the tracer used by Start. A nil tracer disables tracing.
+func SetTracer(t *Tracer) {
+	defaultTracer.Store(t)
+}
+
+type spanKey struct{}
+type remoteKey struct{}
+
+// ContextWithSpan returns a context carrying the span, so that the spans
+// started from it are its children.
+func ContextWithSpan(ctx context.Context, span *Span) context.Context {
+	if span == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, spanKey{}, span)
+}
+
+// SpanFromContext returns the span carried by ctx, or nil.
+func SpanFromContext(ctx context.Context) *Span {
+	span, _ := ctx.Value(spanKey{}).(*Span)
+	return span
+}
+
+// ContextWithRemote returns a context carrying the span context of a calling
+// service, so that the spans started from it continue its trace.
+func ContextWithRemote(ctx context.Context, sc SpanContext) context.Context {
+	if !sc.Valid() {
+		return ctx
+	}
+	return context.WithValue(ctx, remoteKey{}, sc)
+}
+
+// Start starts an internal span as a child of the span carried by ctx, or of
+// the remote span context it carries, or as the root of a new trace.
+func Start(ctx context.Context, name string) (context.Context, *Span) {
+	return StartKind(ctx, name, SpanKindInternal)
+}
+
+// StartKind starts a span of the given kind, as Start does.
+func StartKind(ctx context.Context, name string, kind SpanKind) (context.Context, *Span) {
+	tracer := defaultTracer.Load()
+	if tracer == nil {
+		return ctx, nil
+	}
+
+	span := &Span{tracer: tracer, name: name, kind: kind, start: time.Now()}
+	if parent := SpanFromContext(ctx); parent != nil {
+		span.context.TraceID = parent.context.TraceID
+		span.context.Sampled = parent.context.Sampled
+		span.parent = parent.context.SpanID
+	} else if remote, ok := ctx.Value(remoteKey{}).(SpanContext); ok {
+		span.context.TraceID = remote.TraceID
+		span.context.Sampled = remote.Sampled
+		span.parent = remote.SpanID
+	} else {
+		rand.Read(span.context.TraceID[:])
+		span.context.Sampled = tracer.sample(span.context.TraceID)
+	}
+	rand.Read(span.context.SpanID[:])
+
+	return ContextWithSpan(ctx, span), span
+}
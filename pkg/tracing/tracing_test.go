@@ -0,0 +1,182 @@
+package tracing
+
+import (
+	"backendify/pkg/models"
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type recordingExporter struct {
+	mu    sync.Mutex
+	spans []SpanData
+}
+
+func (e *recordingExporter) Export(spans []SpanData) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.spans = append(e.spans, spans...)
+	return nil
+}
+
+func (e *recordingExporter) Close() error { return nil }
+
+func TestParseTraceparent(t *testing.T) {
+	const value = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+	sc, ok := ParseTraceparent(value)
+	assert.True(t, ok, "Expected a valid traceparent")
+	assert.True(t, sc.Sampled, "Expected the sampled flag")
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", sc.TraceID.String())
+	assert.Equal(t, "00f067aa0ba902b7", sc.SpanID.String())
+	assert.Equal(t, value, sc.Traceparent(), "Expected the value to round-trip")
+
+	for _, invalid := range []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+	} {
+		_, ok := ParseTraceparent(invalid)
+		assert.False(t, ok, "Expected %q to be rejected", invalid)
+	}
+}
+
+func TestStart(t *testing.T) {
+	t.Run("Disabled", func(t *testing.T) {
+		SetTracer(nil)
+		ctx, span := Start(context.Background(), "request")
+		assert.Nil(t, span, "Expected no span without a tracer")
+		assert.Nil(t, SpanFromContext(ctx))
+		// A nil span is safe to use
+		span.SetAttribute("key", "value")
+		span.SetError(errors.New("failed"))
+		span.End()
+	})
+
+	t.Run("Parent and children", func(t *testing.T) {
+		exporter := &recordingExporter{}
+		tracer := newTracer(exporter, 1, nil)
+		SetTracer(tracer)
+		defer SetTracer(nil)
+
+		remote, _ := ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+		ctx, root := StartKind(ContextWithRemote(context.Background(), remote), "request", SpanKindServer)
+		_, child := StartKind(ctx, "upstream", SpanKindClient)
+		child.SetAttribute("country", "us")
+		child.SetError(errors.New("failed"))
+		child.End()
+		root.End()
+		root.End()
+		assert.NoError(t, tracer.Shutdown())
+
+		if !assert.Len(t, exporter.spans, 2, "Expected every span to be exported once") {
+			return
+		}
+		upstream, request := exporter.spans[0], exporter.spans[1]
+		assert.Equal(t, remote.TraceID.String(), request.TraceID, "Expected the remote trace to be continued")
+		assert.Equal(t, remote.SpanID.String(), request.ParentSpanID)
+		assert.Equal(t, request.TraceID, upstream.TraceID)
+		assert.Equal(t, request.SpanID, upstream.ParentSpanID)
+		assert.Equal(t, "us", upstream.Attributes["country"])
+		assert.Equal(t, "failed", upstream.Error)
+		assert.Equal(t, SpanKindServer, request.Kind)
+		assert.Equal(t, SpanKindClient, upstream.Kind)
+	})
+
+	t.Run("Not sampled", func(t *testing.T) {
+		exporter := &recordingExporter{}
+		tracer := newTracer(exporter, 0, nil)
+		SetTracer(tracer)
+		defer SetTracer(nil)
+
+		_, span := Start(context.Background(), "request")
+		assert.True(t, span.Context().Valid(), "Expected the span to still be propagated")
+		span.End()
+		assert.NoError(t, tracer.Shutdown())
+		assert.Empty(t, exporter.spans, "Expected no span to be exported")
+	})
+}
+
+func TestFileExporter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "spans.jsonl")
+	tracer, err := NewTracer(models.TracingConfig{Enabled: true, Exporter: ExporterFile, FilePath: path}, nil)
+	if !assert.NoError(t, err) {
+		return
+	}
+	SetTracer(tracer)
+	defer SetTracer(nil)
+
+	ctx, root := Start(context.Background(), "request")
+	_, child := Start(ctx, "queue")
+	child.End()
+	root.End()
+	assert.NoError(t, tracer.Shutdown())
+
+	file, err := os.Open(path)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer file.Close()
+
+	var names []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var span SpanData
+		assert.NoError(t, json.Unmarshal(scanner.Bytes(), &span))
+		names = append(names, span.Name)
+	}
+	assert.Equal(t, []string{"queue", "request"}, names)
+}
+
+func TestNewTracer(t *testing.T) {
+	tracer, err := NewTracer(models.TracingConfig{}, nil)
+	assert.NoError(t, err)
+	assert.Nil(t, tracer, "Expected no tracer while disabled")
+
+	_, err = NewTracer(models.TracingConfig{Enabled: true, Exporter: "zipkin"}, nil)
+	assert.ErrorIs(t, err, ErrUnknownExporter)
+
+	path := filepath.Join(t.TempDir(), "spans.jsonl")
+	tracer, err = NewTracer(models.TracingConfig{Enabled: true, Exporter: ExporterFile, FilePath: path}, nil)
+	if assert.NoError(t, err) {
+		assert.Equal(t, 1.0, tracer.sampleRatio, "Expected every trace to be sampled by default")
+		assert.NoError(t, tracer.Shutdown())
+	}
+	noSampling := 0.0
+	tracer, err = NewTracer(models.TracingConfig{Enabled: true, Exporter: ExporterFile, FilePath: path, SampleRatio: &noSampling}, nil)
+	if assert.NoError(t, err) {
+		assert.Equal(t, 0.0, tracer.sampleRatio, "Expected a ratio of 0 to turn sampling off")
+		// The lowest trace ID is the first sampled by any ratio above 0
+		assert.False(t, tracer.sample(TraceID{}))
+		assert.NoError(t, tracer.Shutdown())
+	}
+}
+
+func TestOTLPRequest(t *testing.T) {
+	exporter := NewOTLPExporter("http://localhost:4318/v1/traces", "backendify")
+	request := exporter.request([]SpanData{
+		{Name: "GET /company", Kind: SpanKindServer},
+		{Name: "upstream", Kind: SpanKindClient, Error: "failed"},
+		{Name: "queue", Kind: SpanKindInternal},
+	})
+
+	spans := request.ResourceSpans[0].ScopeSpans[0].Spans
+	if !assert.Len(t, spans, 3) {
+		return
+	}
+	// SPAN_KIND_SERVER, SPAN_KIND_CLIENT and SPAN_KIND_INTERNAL
+	assert.Equal(t, 2, spans[0].Kind)
+	assert.Equal(t, 3, spans[1].Kind)
+	assert.Equal(t, 1, spans[2].Kind)
+	assert.Equal(t, otlpStatusError, spans[1].Status.Code)
+}